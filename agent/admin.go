@@ -0,0 +1,222 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+)
+
+type (
+	// PluginInfo is the information of a loaded plugin.
+	PluginInfo struct {
+		Name   string `json:"name"`
+		Kind   string `json:"kind"`
+		System bool   `json:"system"`
+		// Capabilities are the capability interfaces implemented by the plugin.
+		Capabilities []string `json:"capabilities"`
+		// Spec is the effective spec whose secrets are redacted.
+		Spec map[string]interface{} `json:"spec"`
+	}
+)
+
+// handleAdminRequest handles the requests to the agent itself,
+// it returns false if the request is not handled. The agent config
+// is handled by handleConfig after the plugins, please see Agent.ServeHTTP.
+func (a *Agent) handleAdminRequest(w http.ResponseWriter, r *http.Request, set *pluginSet) bool {
+	switch {
+	case r.URL.Path == "/plugins":
+		handlePlugins(w, r, set)
+		return true
+	case strings.HasPrefix(r.URL.Path, "/plugins/"):
+		handlePlugin(w, r, set, strings.TrimPrefix(r.URL.Path, "/plugins/"))
+		return true
+	default:
+		return false
+	}
+}
+
+// handleConfig applies the agent config to the plugins implementing plugins.AgentConfigurer
+// except for GET, and responds the current effective values of them.
+// The values of config are strings, and the numbers and bools are accepted too,
+// the other values such as objects, arrays and null are skipped.
+func handleConfig(w http.ResponseWriter, r *http.Request, set *pluginSet) {
+	var configurers []plugins.AgentConfigurer
+	for _, plug := range set.plugins() {
+		if configurer, ok := plug.(plugins.AgentConfigurer); ok {
+			configurers = append(configurers, configurer)
+		}
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		config, err := readAgentConfig(r)
+		if err != nil {
+			log.Printf("read agent config failed: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = applyAgentConfig(configurers, config)
+		if err != nil {
+			log.Printf("apply agent config failed: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	effective := map[string]string{}
+	for _, configurer := range configurers {
+		for key, value := range configurer.AgentConfig() {
+			effective[key] = value
+		}
+	}
+
+	writeJSON(w, effective)
+}
+
+// applyAgentConfig applies the config to all configurers or none. The config is validated
+// by the plugins.AgentConfigValidator first, then applied in order. If any configurer
+// fails to apply, the ones already applied are rolled back to their previous values.
+func applyAgentConfig(configurers []plugins.AgentConfigurer, config map[string]string) error {
+	var errs Errors
+	for _, configurer := range configurers {
+		validator, ok := configurer.(plugins.AgentConfigValidator)
+		if !ok {
+			continue
+		}
+		err := validator.ValidateAgentConfig(config)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", configurer.(plugins.Plugin).Name(), err))
+		}
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+
+	previous := make([]map[string]string, len(configurers))
+	for i, configurer := range configurers {
+		previous[i] = configurer.AgentConfig()
+	}
+
+	for i, configurer := range configurers {
+		err := configurer.ApplyAgentConfig(config)
+		if err == nil {
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %v", configurer.(plugins.Plugin).Name(), err))
+		for j := i - 1; j >= 0; j-- {
+			err := configurers[j].ApplyAgentConfig(previous[j])
+			if err != nil {
+				log.Printf("%s: roll back agent config failed: %v",
+					configurers[j].(plugins.Plugin).Name(), err)
+			}
+		}
+		return errs
+	}
+
+	return nil
+}
+
+func readAgentConfig(r *http.Request) (map[string]string, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(body, &values); err != nil {
+		return nil, fmt.Errorf("unmarshal body failed: %v", err)
+	}
+
+	config := make(map[string]string, len(values))
+	for key, value := range values {
+		switch value := value.(type) {
+		case string:
+			config[key] = value
+		case float64:
+			config[key] = strconv.FormatFloat(value, 'f', -1, 64)
+		case bool:
+			config[key] = strconv.FormatBool(value)
+		default:
+			// NOTE: The structured values are not for the agent, such as the extra keys of
+			// control plane, so they are skipped like the unknown keys.
+		}
+	}
+
+	return config, nil
+}
+
+// handlePlugins responds the loaded plugins in load order.
+func handlePlugins(w http.ResponseWriter, r *http.Request, set *pluginSet) {
+	infos := make([]*PluginInfo, 0, len(set.entries))
+	for _, entry := range set.entries {
+		infos = append(infos, newPluginInfo(entry))
+	}
+
+	writeJSON(w, infos)
+}
+
+// handlePlugin responds the plugin by name.
+func handlePlugin(w http.ResponseWriter, r *http.Request, set *pluginSet, name string) {
+	entry := set.get(name)
+	if entry == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, newPluginInfo(entry))
+}
+
+func newPluginInfo(entry *pluginEntry) *PluginInfo {
+	info := &PluginInfo{
+		Name:         entry.spec.Name(),
+		Kind:         entry.spec.Kind(),
+		Capabilities: plugins.Capabilities(entry.plugin),
+	}
+
+	if cons := plugins.GetConstructor(info.Kind); cons != nil {
+		info.System = cons.SystemPlugin
+	}
+
+	spec, err := plugins.RedactSpec(entry.spec)
+	if err != nil {
+		log.Printf("redact spec of plugin %s failed: %v", info.Name, err)
+	}
+	info.Spec = spec
+
+	return info
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	buff, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("marshal %T failed: %v", v, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buff)
+}
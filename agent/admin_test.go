@@ -0,0 +1,222 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+	"github.com/megaease/easeagent-sdk-go/plugins/easemesh"
+	"github.com/megaease/easeagent-sdk-go/plugins/zipkin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPluginsEndpoint(t *testing.T) {
+	zipkinSpec := newTestZipkinSpec(&memReporter{})
+	zipkinSpec.EnableBasicAuth = true
+	zipkinSpec.Username = "user"
+	zipkinSpec.Password = "secret-password"
+	a, err := NewWithOptions(WithSpec(zipkinSpec), WithSpec(newTestSpec("test", nil)))
+	assert.Nil(t, err)
+	defer a.Close()
+
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/plugins", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.NotContains(t, w.Body.String(), "secret-password")
+
+	var infos []*PluginInfo
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &infos))
+	assert.Len(t, infos, 3)
+
+	// The plugins are in load order.
+	assert.Equal(t, "test", infos[0].Name)
+	assert.Equal(t, "Health", infos[1].Name)
+	assert.True(t, infos[1].System)
+	assert.Equal(t, []string{"AgentHandler"}, infos[1].Capabilities)
+
+	zipkinInfo := infos[2]
+	assert.Equal(t, "Zipkin", zipkinInfo.Name)
+	assert.Equal(t, "Zipkin", zipkinInfo.Kind)
+	assert.False(t, zipkinInfo.System)
+	assert.Equal(t, []string{"AgentHandler", "UserHandlerFuncWrapper", "UserClientWrapper", "UserClientRequestWrapper", "Reloader", "AgentConfigurer", "AgentConfigValidator"},
+		zipkinInfo.Capabilities)
+	assert.Equal(t, "user", zipkinInfo.Spec["reporter.output.server.auth.username"])
+	assert.Equal(t, plugins.RedactedValue, zipkinInfo.Spec["reporter.output.server.auth.password"])
+	assert.Equal(t, "", zipkinInfo.Spec["reporter.output.server.tls.key"])
+	assert.Equal(t, 1.0, zipkinInfo.Spec["tracing.sample.rate"])
+
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/plugins/Zipkin", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var info PluginInfo
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, *zipkinInfo, info)
+
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/plugins/none", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestConfigEndpoint(t *testing.T) {
+	rep := &memReporter{}
+	a, err := NewWithOptions(WithSpec(newTestZipkinSpec(rep)), WithSpec(easemesh.DefaultSpec()))
+	assert.Nil(t, err)
+	defer a.Close()
+
+	getConfig := func() map[string]string {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/config", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		config := map[string]string{}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &config))
+		return config
+	}
+
+	assert.Equal(t, map[string]string{
+		"tracing.enable":                       "true",
+		"tracing.sample.rate":                  "1",
+		"tracing.sample.paths":                 "",
+		"tracing.sample.overrideUpstream":      "false",
+		"easeagent.progress.forwarded.headers": "",
+	}, getConfig())
+
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(`{
+		"tracing.sample.rate": 0,
+		"tracing.sample.paths": "/keep=1,/keep/drop*=0",
+		"easeagent.progress.forwarded.headers": "X-Canary"
+	}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]string{
+		"tracing.enable":                       "true",
+		"tracing.sample.rate":                  "0",
+		"tracing.sample.paths":                 "/keep/drop*=0,/keep=1",
+		"tracing.sample.overrideUpstream":      "false",
+		"easeagent.progress.forwarded.headers": "X-Canary",
+	}, getConfig())
+
+	// The sampling settings are applied live.
+	handler := a.WrapUserHandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, path := range []string{"/other", "/keep", "/keep/drop/1"} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	assert.Nil(t, a.Close())
+	spans := rep.Flushed()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "/keep", spans[0].Tags["http.path"])
+}
+
+// configHandlerPlugin handles /config itself.
+type configHandlerPlugin struct {
+	testPlugin
+}
+
+func (p *configHandlerPlugin) HandleAgentRequest(w http.ResponseWriter, r *http.Request) bool {
+	if r.URL.Path != "/config" {
+		return false
+	}
+	w.Write([]byte(p.spec.Value))
+	return true
+}
+
+func TestConfigEndpointHandledByPlugin(t *testing.T) {
+	const kind = "AgentTestConfigHandler"
+	plugins.Register(&plugins.Constructor{
+		Kind: kind,
+		DefaultSpec: func() plugins.Spec {
+			return testSpec{BaseSpec: plugins.BaseSpec{KindField: kind}}
+		},
+		NewInstance: func(spec plugins.Spec) (plugins.Plugin, error) {
+			return &configHandlerPlugin{testPlugin{spec: spec.(testSpec)}}, nil
+		},
+	})
+
+	spec := testSpec{BaseSpec: plugins.BaseSpec{KindField: kind, NameField: "config-handler"}, Value: "own config"}
+	a, err := NewWithOptions(WithSpec(newTestZipkinSpec(&memReporter{})), WithSpec(spec))
+	assert.Nil(t, err)
+	defer a.Close()
+
+	// The plugin handling /config wins over the agent config.
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(`{"tracing.enable": false}`)))
+	assert.Equal(t, "own config", w.Body.String())
+	tracing := a.GetPlugin(zipkin.Name).(plugins.AgentConfigurer)
+	assert.Equal(t, "true", tracing.AgentConfig()["tracing.enable"])
+}
+
+func TestConfigEndpointInvalid(t *testing.T) {
+	a, err := NewWithOptions(WithSpec(newTestZipkinSpec(&memReporter{})))
+	assert.Nil(t, err)
+	defer a.Close()
+
+	for _, body := range []string{
+		`{"tracing.sample.rate": 2, "tracing.enable": false}`,
+		`{"tracing.sample.paths": "/keep"}`,
+		`not json`,
+	} {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	// The invalid config is applied nothing.
+	tracing := a.GetPlugin(zipkin.Name).(plugins.AgentConfigurer)
+	assert.Equal(t, "true", tracing.AgentConfig()["tracing.enable"])
+
+	// The structured values are skipped, and the others are applied.
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(`{
+		"tracing.enable": [true],
+		"mesh.extra": {"zone": "a"},
+		"mesh.none": null,
+		"tracing.sample.rate": 0.5
+	}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", tracing.AgentConfig()["tracing.enable"])
+	assert.Equal(t, "0.5", tracing.AgentConfig()["tracing.sample.rate"])
+}
+
+func TestConfigEndpointAllOrNothing(t *testing.T) {
+	a, err := NewWithOptions(WithSpec(newTestZipkinSpec(&memReporter{})), WithSpec(easemesh.DefaultSpec()))
+	assert.Nil(t, err)
+	defer a.Close()
+
+	tracing := a.GetPlugin(zipkin.Name).(plugins.AgentConfigurer)
+	mesh := a.GetPlugin(easemesh.DefaultSpec().Name()).(plugins.AgentConfigurer)
+	rate := tracing.AgentConfig()["tracing.sample.rate"]
+
+	for _, body := range []string{
+		`{"tracing.sample.rate": 2, "easeagent.progress.forwarded.headers": "X-Canary"}`,
+		`{"tracing.sample.rate": 0.5, "easeagent.progress.forwarded.headers": "/[/"}`,
+	} {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+
+		// None of the plugins applies the config.
+		assert.Equal(t, rate, tracing.AgentConfig()["tracing.sample.rate"], body)
+		assert.Equal(t, "", mesh.AgentConfig()["easeagent.progress.forwarded.headers"], body)
+	}
+}
@@ -20,8 +20,12 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/megaease/easeagent-sdk-go/plugins"
 	"golang.org/x/exp/maps"
@@ -30,36 +34,115 @@ import (
 type (
 	// Agent is the agent entry.
 	Agent struct {
-		config  *Config
-		plugins []plugins.Plugin
+		config *Config
+
+		// mutex serializes the changes of plugins.
+		mutex   sync.Mutex
+		plugins atomic.Value // type: *pluginSet
+		closed  bool
+
+		listener net.Listener
+		server   *http.Server
+
+		options   []ConfigOption
+		watchStop chan struct{}
+
+		closeOnce sync.Once
+		closeDone chan struct{}
+		closeErrs []error
 	}
 
 	// Config is the Agent config.
 	Config struct {
-		Address string         `json:"address"`
-		Plugins []plugins.Spec `json:"plugins"`
+		// Address is the address of agent server, empty value runs no agent server.
+		Address string `json:"address" jsonschema_description:"the address of agent server, empty value runs no agent server"`
+		// Listener is used to run agent server instead of listening Address,
+		// which could be any net.Listener such as Unix domain socket.
+		Listener net.Listener   `json:"-"`
+		Plugins  []plugins.Spec `json:"plugins"`
+
+		// yamlFiles are the files loaded by options, which are watched for reloading.
+		yamlFiles []string
+		// reload enables reloading config, reloadInterval <= 0 means no file watching.
+		reload         bool
+		reloadInterval time.Duration
+		// errs are the errors of loading config by options.
+		errs []error
+		// warnings are the problems tolerated unless strict, such as unknown keys.
+		warnings []error
+		// strict fails creating agent on any problem of config, please see WithStrictConfig.
+		strict bool
+		// remote polls the config server, please see WithRemoteConfig.
+		remote *remoteClient
 	}
 
 	// HandlerWrapper is the HTTP handler wrapper.
 	HandlerWrapper struct {
 		handlerFunc http.HandlerFunc
 	}
+
+	// userHandlerFunc wraps the user handler function with the current plugins,
+	// it rebuilds the wrapped function once the plugins changed.
+	userHandlerFunc struct {
+		agent       *Agent
+		handlerFunc http.HandlerFunc
+		wrapped     atomic.Value // type: *wrappedHandlerFunc
+	}
+
+	wrappedHandlerFunc struct {
+		generation  uint64
+		handlerFunc http.HandlerFunc
+	}
+
+	// userClient wraps the user client with the current plugins,
+	// it rebuilds the wrapped client once the plugins changed.
+	userClient struct {
+		agent    *Agent
+		httpDoer plugins.HTTPDoer
+		wrapped  atomic.Value // type: *wrappedClient
+	}
+
+	wrappedClient struct {
+		generation uint64
+		httpDoer   plugins.HTTPDoer
+	}
 )
 
 // New creates an agent.
 func New(config *Config) (*Agent, error) {
 	agent := &Agent{
-		config: config,
+		config:    config,
+		watchStop: make(chan struct{}),
+		closeDone: make(chan struct{}),
 	}
 
+	specs, err := resolveSpecs(config)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := newPluginEntries(specs)
+	if err != nil {
+		return nil, err
+	}
+	agent.plugins.Store(newPluginSet(0, entries))
+
+	err = agent.serve()
+	if err != nil {
+		closePlugins(entries)
+		return nil, err
+	}
+
+	return agent, nil
+}
+
+// resolveSpecs returns the specs in config and the default specs of the system plugins
+// which are not specified in config, they are sorted in load order.
+func resolveSpecs(config *Config) ([]plugins.Spec, error) {
 	systemConstructors := plugins.SystemConstructors()
-	var plugs []plugins.Plugin
-	for i, spec := range config.Plugins {
-		plug, err := plugins.New(spec)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create No.%d plugin: %v", i+1, err)
-		}
-		plugs = append(plugs, plug)
+	specs := make([]plugins.Spec, 0, len(config.Plugins)+len(systemConstructors))
+	for _, spec := range config.Plugins {
+		specs = append(specs, spec)
 		delete(systemConstructors, spec.Kind())
 	}
 
@@ -69,38 +152,194 @@ func New(config *Config) (*Agent, error) {
 	sort.Sort(plugins.ConstructorsByKind(systemCons))
 
 	for _, cons := range systemCons {
-		plug, err := cons.NewInstance(cons.DefaultSpec())
+		specs = append(specs, cons.DefaultSpec())
+	}
+
+	err := checkNames(specs)
+	if err != nil {
+		return nil, err
+	}
+
+	return plugins.SortSpecs(specs)
+}
+
+func newPluginEntries(specs []plugins.Spec) ([]*pluginEntry, error) {
+	var entries []*pluginEntry
+	for i, spec := range specs {
+		plug, err := plugins.New(spec)
+		if err != nil {
+			closePlugins(entries)
+			return nil, fmt.Errorf("failed to create No.%d plugin: %v", i+1, err)
+		}
+		entries = append(entries, &pluginEntry{spec: spec, plugin: plug})
+	}
+
+	return entries, nil
+}
+
+func checkNames(specs []plugins.Spec) error {
+	names := map[string]struct{}{}
+	for _, spec := range specs {
+		if _, exists := names[spec.Name()]; exists {
+			return fmt.Errorf("plugin name %s is duplicated", spec.Name())
+		}
+		names[spec.Name()] = struct{}{}
+	}
+
+	return nil
+}
+
+// serve binds the listener synchronously, then serves the agent server in the background.
+func (a *Agent) serve() error {
+	listener := a.config.Listener
+	if listener == nil {
+		if a.config.Address == "" {
+			return nil
+		}
+
+		var err error
+		listener, err = net.Listen("tcp", a.config.Address)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create system plugin %s: %v", cons.Kind, err)
+			return fmt.Errorf("agent listen %s failed: %v", a.config.Address, err)
 		}
-		plugs = append(plugs, plug)
 	}
-	agent.plugins = plugs
+
+	a.listener = listener
+	a.server = &http.Server{
+		Handler: a,
+	}
 
 	go func() {
-		err := http.ListenAndServe(config.Address, agent)
+		err := a.server.Serve(listener)
 		if err != nil && err != http.ErrServerClosed {
-			log.Printf("easemesh agent listen %s failed: %v", config.Address, err)
+			log.Printf("easemesh agent serve %s failed: %v", listener.Addr(), err)
 		}
 	}()
 
-	return agent, nil
+	return nil
+}
+
+// Addr returns the address of agent server, it returns nil if there is no agent server.
+func (a *Agent) Addr() net.Addr {
+	if a.listener == nil {
+		return nil
+	}
+
+	return a.listener.Addr()
+}
+
+// Shutdown closes all plugins in reverse load order, then gracefully shuts down
+// the agent server, so the health checks are served until the service is deregistered.
+// The plugins are closed after the in-flight requests and clients using them are done,
+// or the ctx is done. It gives up waiting when the ctx is done, the plugins which are
+// still closing keep going in the background.
+func (a *Agent) Shutdown(ctx context.Context) error {
+	var errs Errors
+
+	a.closeOnce.Do(func() {
+		a.mutex.Lock()
+		a.closed = true
+		a.mutex.Unlock()
+
+		close(a.watchStop)
+		go a.closePlugins(ctx)
+	})
+
+	select {
+	case <-a.closeDone:
+		errs = append(errs, a.closeErrs...)
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("close plugins failed: %w", ctx.Err()))
+	}
+
+	if a.server != nil {
+		err := a.server.Shutdown(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("shutdown agent server failed: %v", err))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// Close closes the agent, it's the same as Shutdown without deadline.
+func (a *Agent) Close() error {
+	return a.Shutdown(context.Background())
+}
+
+func (a *Agent) closePlugins(ctx context.Context) {
+	defer close(a.closeDone)
+
+	set := a.pluginSet()
+	set.retire()
+	select {
+	case <-set.drained:
+	case <-ctx.Done():
+	}
+
+	a.closeErrs = closePlugins(set.entries)
+}
+
+// closePlugins closes plugins in reverse order, and returns all errors.
+func closePlugins(entries []*pluginEntry) []error {
+	var errs []error
+	for i := len(entries) - 1; i >= 0; i-- {
+		plug := entries[i].plugin
+		err := plug.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("close plugin %s failed: %v", plug.Name(), err))
+		}
+	}
+
+	return errs
+}
+
+func (a *Agent) pluginSet() *pluginSet {
+	return a.plugins.Load().(*pluginSet)
+}
+
+// acquirePlugins returns the current plugin set, the caller must release it after using.
+func (a *Agent) acquirePlugins() *pluginSet {
+	for {
+		set := a.pluginSet()
+		set.acquire()
+
+		// NOTE: The set might be retired between loading and acquiring,
+		// in which case it must not be used.
+		if set == a.pluginSet() {
+			return set
+		}
+		set.release()
+	}
 }
 
 // GetPlugin gets Plugin by name
 func (a *Agent) GetPlugin(name string) plugins.Plugin {
-	for _, plug := range a.plugins {
-		if plug.Name() == name {
-			return plug
-		}
+	entry := a.pluginSet().get(name)
+	if entry == nil {
+		return nil
 	}
-	return nil
+
+	return entry.plugin
 }
 
-// ServeHTTP invokes every plugin which is http.Handler to handle the request.
+// ServeHTTP handles the admin requests such as /plugins, then invokes every plugin
+// which is http.Handler to handle the request. The /config not handled by any plugin
+// is dispatched to the plugins implementing plugins.AgentConfigurer.
 // NOTE: If the request is not matched for your plugin, don't do anything.
 func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	for _, plug := range a.plugins {
+	set := a.acquirePlugins()
+	defer set.release()
+
+	if a.handleAdminRequest(w, r, set) {
+		return
+	}
+
+	for _, plug := range set.plugins() {
 		handler, ok := plug.(plugins.AgentHandler)
 		if !ok {
 			continue
@@ -111,11 +350,38 @@ func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+
+	if r.URL.Path == "/config" {
+		handleConfig(w, r, set)
+	}
 }
 
 // WrapUserHandlerFunc wraps the handlerFunc with the wrap functions from every plugin.
+// The wrapped function follows the changes of plugins without being re-wrapped.
 func (a *Agent) WrapUserHandlerFunc(handlerFunc http.HandlerFunc) http.HandlerFunc {
-	for _, plug := range a.plugins {
+	h := &userHandlerFunc{
+		agent:       a,
+		handlerFunc: handlerFunc,
+	}
+
+	return h.ServeHTTP
+}
+
+func (h *userHandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	set := h.agent.acquirePlugins()
+	defer set.release()
+
+	h.wrap(set)(w, r)
+}
+
+func (h *userHandlerFunc) wrap(set *pluginSet) http.HandlerFunc {
+	wrapped, _ := h.wrapped.Load().(*wrappedHandlerFunc)
+	if wrapped != nil && wrapped.generation == set.generation {
+		return wrapped.handlerFunc
+	}
+
+	handlerFunc := h.handlerFunc
+	for _, plug := range set.plugins() {
 		wrapper, ok := plug.(plugins.UserHandlerFuncWrapper)
 		if !ok {
 			continue
@@ -124,6 +390,11 @@ func (a *Agent) WrapUserHandlerFunc(handlerFunc http.HandlerFunc) http.HandlerFu
 		handlerFunc = wrapper.WrapUserHandlerFunc(handlerFunc)
 	}
 
+	h.wrapped.Store(&wrappedHandlerFunc{
+		generation:  set.generation,
+		handlerFunc: handlerFunc,
+	})
+
 	return handlerFunc
 }
 
@@ -139,8 +410,30 @@ func (h *HandlerWrapper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // WrapUserClient wraps the client with the wrap functions from every enabled plugin.
+// The wrapped client follows the changes of plugins without being re-wrapped.
 func (a *Agent) WrapUserClient(httpDoer plugins.HTTPDoer) plugins.HTTPDoer {
-	for _, plug := range a.plugins {
+	return &userClient{
+		agent:    a,
+		httpDoer: httpDoer,
+	}
+}
+
+// Do implements plugins.HTTPDoer.
+func (c *userClient) Do(req *http.Request) (*http.Response, error) {
+	set := c.agent.acquirePlugins()
+	defer set.release()
+
+	return c.wrap(set).Do(req)
+}
+
+func (c *userClient) wrap(set *pluginSet) plugins.HTTPDoer {
+	wrapped, _ := c.wrapped.Load().(*wrappedClient)
+	if wrapped != nil && wrapped.generation == set.generation {
+		return wrapped.httpDoer
+	}
+
+	httpDoer := c.httpDoer
+	for _, plug := range set.plugins() {
 		wrapper, ok := plug.(plugins.UserClientWrapper)
 		if !ok {
 			continue
@@ -149,12 +442,20 @@ func (a *Agent) WrapUserClient(httpDoer plugins.HTTPDoer) plugins.HTTPDoer {
 		httpDoer = wrapper.WrapUserClient(httpDoer)
 	}
 
+	c.wrapped.Store(&wrappedClient{
+		generation: set.generation,
+		httpDoer:   httpDoer,
+	})
+
 	return httpDoer
 }
 
 // WrapHTTPRequest wraps the request with the parent conext from every enabled plugin.
 func (a *Agent) WrapHTTPRequest(parent context.Context, req *http.Request) *http.Request {
-	for _, plug := range a.plugins {
+	set := a.acquirePlugins()
+	defer set.release()
+
+	for _, plug := range set.plugins() {
 		wrapper, ok := plug.(plugins.UserClientRequestWrapper)
 		if !ok {
 			continue
@@ -21,11 +21,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
+	"time"
 
 	"github.com/megaease/easeagent-sdk-go/plugins"
 	"github.com/megaease/easeagent-sdk-go/plugins/easemesh"
-	"github.com/megaease/easeagent-sdk-go/plugins/health"
 	"github.com/megaease/easeagent-sdk-go/plugins/zipkin"
+	"golang.org/x/exp/slices"
 	"gopkg.in/yaml.v2"
 )
 
@@ -35,17 +37,74 @@ type ConfigOption func(c *Config)
 
 // NewWithOptions returns a new Agent.
 func NewWithOptions(options ...ConfigOption) (*Agent, error) {
+	config := newConfig(options...)
+	if config.strict {
+		err := config.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	contents := readFiles(config.yamlFiles)
+	agent, err := New(config)
+	if err != nil {
+		return nil, err
+	}
+
+	agent.options = options
+	if config.reload {
+		agent.watch(config.yamlFiles, contents, config.reloadInterval)
+	}
+	if config.remote != nil {
+		agent.pollRemote(config.remote)
+	}
+
+	return agent, nil
+}
+
+// LoadConfig loads the config by options without creating the Agent, which is useful
+// for checking config files. It reports all problems of the config as WithStrictConfig does,
+// the config is returned along with the error.
+func LoadConfig(options ...ConfigOption) (*Config, error) {
+	config := newConfig(options...)
+	return config, config.validate()
+}
+
+func newConfig(options ...ConfigOption) *Config {
 	config := &Config{
 		Plugins: make([]plugins.Spec, 0),
 	}
 	for _, option := range options {
 		option(config)
 	}
-	return New(config)
+	return config
+}
+
+// WithStrictConfig fails NewWithOptions instead of falling back to defaults on any problem of config,
+// such as unreadable files, unknown keys, mismatched types and invalid plugin specs.
+// All problems are reported together in agent.Errors. It also applies to reloading config.
+// @return ConfigOption
+func WithStrictConfig() ConfigOption {
+	return func(c *Config) {
+		c.strict = true
+	}
+}
+
+// WithReload enables reloading config on SIGHUP, and watching the YAML files
+// loaded by the other options every interval.
+// The options are applied again to build the new config, which is rejected
+// if any of them failed to load it, please see Agent.Reload for details.
+// @param  interval time.Duration the interval of checking files, interval <= 0 means no watching
+// @return ConfigOption
+func WithReload(interval time.Duration) ConfigOption {
+	return func(c *Config) {
+		c.reload = true
+		c.reloadInterval = interval
+	}
 }
 
 // WithAddress Sets address to Config.
-// @param  address string agent http api address
+// @param  address string agent http api address, empty address runs no agent server
 // @return ConfigOption
 func WithAddress(address string) ConfigOption {
 	return func(c *Config) {
@@ -53,6 +112,15 @@ func WithAddress(address string) ConfigOption {
 	}
 }
 
+// WithListener Sets listener to Config, the agent server serves on it instead of listening address.
+// @param  listener net.Listener such as Unix domain socket listener
+// @return ConfigOption
+func WithListener(listener net.Listener) ConfigOption {
+	return func(c *Config) {
+		c.Listener = listener
+	}
+}
+
 // WithSpec Append spec the Agent Plugin Spec.
 // @param  spec plugins.Spec
 // @return ConfigOption
@@ -67,20 +135,12 @@ func WithSpec(spec plugins.Spec) ConfigOption {
 // @return ConfigOption
 func WithEaseMeshYAML(yamlFile string) ConfigOption {
 	return func(c *Config) {
-		var easeMeshSpec easemesh.Spec
-		var spec plugins.Spec
-		if bodyJSON, err := yamlToJSON(yamlFile); err != nil {
-			log.Printf("yaml to json failed: %v, use default easemesh spec", err)
-			spec = easemesh.DefaultSpec()
-		} else if err = json.Unmarshal(bodyJSON, &easeMeshSpec); err != nil {
-			log.Printf("unmarshal %s to %T failed: %v, use default easemesh spec", bodyJSON, spec, err)
-			spec = easemesh.DefaultSpec()
-		} else {
-			easeMeshSpec.KindField = easemesh.Kind
-			easeMeshSpec.NameField = easemesh.Name
-			spec = easeMeshSpec
+		resolved := c.load(yamlFile)
+		for _, spec := range resolved.Plugins {
+			if spec.Kind() == easemesh.Kind {
+				c.Plugins = append(c.Plugins, spec)
+			}
 		}
-		c.Plugins = append(c.Plugins, spec)
 	}
 }
 
@@ -92,19 +152,13 @@ func WithEaseMeshYAML(yamlFile string) ConfigOption {
 // @return ConfigOption
 func WithZipkinYAML(yamlFile string, localHostPort string) ConfigOption {
 	return func(c *Config) {
-		var spec zipkin.Spec
-		if bodyJSON, err := yamlToJSON(yamlFile); err != nil {
-			log.Printf("yaml to json failed: %v, use default Console Reporter for tracing", err)
-			spec = zipkin.NewConsoleReportSpec(localHostPort)
-		} else if err = json.Unmarshal(bodyJSON, &spec); err != nil {
-			log.Printf("unmarshal %s to %T failed: %v, use default Console Reporter for tracing.", bodyJSON, spec, err)
-			spec = zipkin.NewConsoleReportSpec(localHostPort)
-		} else {
-			spec.KindField = zipkin.Kind
-			spec.NameField = zipkin.Name
-			spec.LocalHostport = localHostPort
+		resolved := c.load(yamlFile)
+		for _, spec := range resolved.Plugins {
+			if zipkinSpec, ok := spec.(zipkin.Spec); ok {
+				zipkinSpec.LocalHostport = localHostPort
+				c.Plugins = append(c.Plugins, zipkinSpec)
+			}
 		}
-		c.Plugins = append(c.Plugins, spec)
 	}
 }
 
@@ -115,16 +169,125 @@ func WithZipkinYAML(yamlFile string, localHostPort string) ConfigOption {
 // @return ConfigOption
 func WithYAML(yamlFile string, localHostPort string) ConfigOption {
 	return func(c *Config) {
-		bodyJSON, err := yamlToJSON(yamlFile)
-		if err == nil {
-			err = json.Unmarshal(bodyJSON, &c)
-			if err != nil {
-				log.Printf("unmarshal %s to %T failed: %v, can't load base config", bodyJSON, c, err)
+		resolved := c.load(yamlFile)
+		c.Address = resolved.Address
+		for _, spec := range resolved.Plugins {
+			if zipkinSpec, ok := spec.(zipkin.Spec); ok {
+				zipkinSpec.LocalHostport = localHostPort
+				spec = zipkinSpec
 			}
+			c.Plugins = append(c.Plugins, spec)
+		}
+	}
+}
+
+// WithLoader sets address, Append the plugin specs resolved by the loader to the Agent Plugin Spec.
+// The errors of the loader are recorded, and the config is skipped if it could not be resolved.
+// @param  loader *Loader the loader of layered config sources, please see NewLoader.
+// @return ConfigOption
+func WithLoader(loader *Loader) ConfigOption {
+	return func(c *Config) {
+		c.addFiles(loader.files())
+		resolved, err := loader.Load()
+		if err != nil {
+			log.Printf("load config failed: %v", err)
+			c.errs = append(c.errs, err)
+		}
+		c.addUnknown(resolved)
+		if resolved.Config == nil {
+			return
+		}
+
+		c.Address = resolved.Config.Address
+		c.Plugins = append(c.Plugins, resolved.Config.Plugins...)
+	}
+}
+
+// load loads the config by DefaultLoader, and records the file and the errors.
+// It falls back to the defaults and environment variables if any value is in
+// mismatched type, which is the behavior of the YAML options. The problems of
+// the config skipped are recorded as warnings for WithStrictConfig.
+func (c *Config) load(yamlFile string) *Config {
+	loader := DefaultLoader(yamlFile)
+	c.addFiles(loader.files())
+
+	resolved, err := loader.Load()
+	if err != nil {
+		log.Printf("load config from %s failed: %v", yamlFile, err)
+		c.errs = append(c.errs, err)
+	}
+	c.addUnknown(resolved)
+	if resolved.Config == nil || len(resolved.Invalid) != 0 {
+		if resolved.Config != nil {
+			c.addWarning(resolved.Config.validate())
+		}
+		// NOTE: The errors of environment variables have been recorded above.
+		resolved, _ = DefaultLoader("").Load()
+	}
+
+	return resolved.Config
+}
+
+// addUnknown records the unknown keys of the resolved config as warnings.
+func (c *Config) addUnknown(resolved *Resolved) {
+	for _, key := range resolved.Unknown {
+		c.addWarning(fmt.Errorf("unknown key %s from %s", key, resolved.Provenance[key]))
+	}
+}
+
+// addWarning records the errors as warnings once.
+func (c *Config) addWarning(err error) {
+	for _, err := range appendErrors(nil, err) {
+		// NOTE: The same source might be loaded by several options.
+		if slices.IndexFunc(c.warnings, func(e error) bool { return e.Error() == err.Error() }) < 0 {
+			log.Printf("%v", err)
+			c.warnings = append(c.warnings, err)
+		}
+	}
+}
+
+// validate reports the errors and warnings of loading config, and the invalid plugin specs.
+func (c *Config) validate() error {
+	all := make([]error, 0, len(c.errs)+len(c.warnings))
+	all = append(all, c.errs...)
+	all = append(all, c.warnings...)
+	all = append(all, c.validatePlugins()...)
+
+	var errs Errors
+	// NOTE: The warnings might duplicate the invalid plugin specs.
+	for _, err := range all {
+		if slices.IndexFunc(errs, func(e error) bool { return e.Error() == err.Error() }) < 0 {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// validatePlugins returns the errors of invalid plugin specs.
+func (c *Config) validatePlugins() []error {
+	var errs []error
+	for _, spec := range c.Plugins {
+		err := spec.Validate()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("validate plugin %s failed: %v", spec.Name(), err))
+		}
+	}
+
+	return errs
+}
+
+// addFiles records the files loaded by options.
+func (c *Config) addFiles(files []string) {
+	for _, file := range files {
+		// NOTE: The same file might be loaded by several options.
+		if !slices.Contains(c.yamlFiles, file) {
+			c.yamlFiles = append(c.yamlFiles, file)
 		}
-		c.Plugins = append(c.Plugins, health.DefaultSpec())
-		WithEaseMeshYAML(yamlFile)(c)
-		WithZipkinYAML(yamlFile, localHostPort)(c)
 	}
 }
 
@@ -136,13 +299,40 @@ func yamlToJSON(yamlFile string) ([]byte, error) {
 		return nil, fmt.Errorf("read config file:%s failed: %v", yamlFile, err)
 	} else if err = yaml.Unmarshal(buff, &body); err != nil {
 		return nil, fmt.Errorf("unmarshal yaml file %s to map failed: %v", yamlFile, err)
-	} else if bodyJSON, err := json.Marshal(body); err != nil {
+	} else if body == nil {
+		return nil, fmt.Errorf("yaml file %s is empty", yamlFile)
+	} else if bodyJSON, err := json.Marshal(normalizeYAML(body)); err != nil {
 		return nil, fmt.Errorf("marshal yaml file %s to json failed: %v", yamlFile, err)
 	} else {
 		return bodyJSON, err
 	}
 }
 
+// normalizeYAML converts the nested maps of YAML to the ones with string keys,
+// which could be marshaled to JSON, such as the specs of the plugins list.
+func normalizeYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprintf("%v", key)] = normalizeYAML(value)
+		}
+		return m
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = normalizeYAML(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = normalizeYAML(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
 // WithZipkinTags sets tags of Zipkin Plugin Spec
 // @param tags the Span tags of tracing
 func WithZipkinTags(tags map[string]string) ConfigOption {
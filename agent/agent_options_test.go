@@ -0,0 +1,147 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/megaease/easeagent-sdk-go/plugins/zipkin"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeYAML(t *testing.T, content string) string {
+	yamlFile := filepath.Join(t.TempDir(), "agent.yml")
+	assert.Nil(t, ioutil.WriteFile(yamlFile, []byte(content), 0o644))
+	return yamlFile
+}
+
+func findZipkinSpec(c *Config) zipkin.Spec {
+	for _, spec := range c.Plugins {
+		if spec.Kind() == zipkin.Kind {
+			return spec.(zipkin.Spec)
+		}
+	}
+	return zipkin.Spec{}
+}
+
+func TestWithYAMLEnvOverrides(t *testing.T) {
+	yamlFile := writeYAML(t, "address: :9900\nserviceName: yaml-service\ntracing.sample.rate: 1\n")
+	t.Setenv("EASEAGENT_ADDRESS", "127.0.0.1:0")
+	t.Setenv("EASEAGENT_TRACING_SAMPLE_RATE", "0.25")
+	t.Setenv("EASEAGENT_REPORTER_OUTPUT_SERVER_AUTH_ENABLE", "true")
+
+	config := newConfig(WithYAML(yamlFile, ""))
+	assert.Empty(t, config.errs)
+	assert.Equal(t, "127.0.0.1:0", config.Address)
+
+	spec := findZipkinSpec(config)
+	assert.Equal(t, "yaml-service", spec.ServiceName)
+	assert.Equal(t, 0.25, spec.SampleRate)
+	assert.True(t, spec.EnableBasicAuth)
+}
+
+func TestWithYAMLInvalidEnv(t *testing.T) {
+	t.Setenv("EASEAGENT_TRACING_SAMPLE_RATE", "high")
+	t.Setenv("EASEAGENT_SERVICE_NAME", "env-service")
+
+	config := newConfig(WithZipkinYAML("", ""))
+	assert.Len(t, config.errs, 1)
+	assert.Contains(t, config.errs[0].Error(), "EASEAGENT_TRACING_SAMPLE_RATE")
+
+	spec := findZipkinSpec(config)
+	assert.Equal(t, "env-service", spec.ServiceName)
+	assert.Equal(t, 1.0, spec.SampleRate)
+}
+
+func TestWithStrictConfig(t *testing.T) {
+	yamlFile := writeYAML(t, "address: 127.0.0.1:0\ntracing.sample.rat: 0.5\ntracing.enable: maybe\n"+
+		"tracing.sample.rate: 2\nreporter.output.server: localhost:9411\n")
+
+	// It falls back to defaults without strict config.
+	a, err := NewWithOptions(WithYAML(yamlFile, ""))
+	assert.Nil(t, err)
+	assert.Nil(t, a.Close())
+
+	_, err = NewWithOptions(WithYAML(yamlFile, ""), WithStrictConfig())
+	assert.NotNil(t, err)
+
+	msg := err.Error()
+	assert.Contains(t, msg, "invalid tracing.enable: want bool, got string maybe")
+	assert.Contains(t, msg, "unknown key tracing.sample.rat from yaml:"+yamlFile)
+	assert.Contains(t, msg, "tracing.sample.rate 2 is out of range [0, 1]")
+	assert.Contains(t, msg, `invalid reporter.output.server "localhost:9411"`)
+
+	_, err = NewWithOptions(WithYAML("not-exist.yml", ""), WithStrictConfig())
+	assert.Contains(t, err.Error(), "not-exist.yml")
+
+	a, err = NewWithOptions(WithYAML("", ""), WithStrictConfig(), WithAddress(""))
+	assert.Nil(t, err)
+	assert.Nil(t, a.Close())
+}
+
+func TestWithYAMLPluginsList(t *testing.T) {
+	yamlFile := writeYAML(t, `address: 127.0.0.1:0
+serviceName: flat-service
+plugins:
+- kind: AgentTest
+  name: test-a
+  value: a
+- kind: AgentTest
+  name: test-b
+  value: b
+- kind: Zipkin
+  name: Zipkin
+  serviceName: list-service
+  tracing.sample.rate: 0.5
+`)
+
+	a, err := NewWithOptions(WithYAML(yamlFile, ""), WithStrictConfig())
+	assert.Nil(t, err)
+	defer a.Close()
+
+	var names []string
+	for _, spec := range a.pluginSet().specs() {
+		names = append(names, spec.Name())
+	}
+	assert.ElementsMatch(t, []string{"Health", "EaseMesh", "Zipkin", "test-a", "test-b"}, names)
+
+	spec := findZipkinSpec(a.config)
+	assert.Equal(t, "list-service", spec.ServiceName)
+	assert.Equal(t, 0.5, spec.SampleRate)
+	assert.True(t, spec.EnableTracing)
+
+	testA, ok := PluginAs[*testPlugin](a, "test-a")
+	assert.True(t, ok)
+	assert.Equal(t, "a", testA.spec.Value)
+}
+
+func TestWithYAMLInvalidPluginsList(t *testing.T) {
+	yamlFile := writeYAML(t, `plugins:
+- kind: NotFound
+  name: not-found
+- kind: AgentTest
+  name: test-a
+  value: [a]
+`)
+
+	_, err := LoadConfig(WithYAML(yamlFile, ""))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "plugins[0]: plugin kind NotFound not found")
+	assert.Contains(t, err.Error(), "plugins[1]: unmarshal")
+}
@@ -0,0 +1,292 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+	"github.com/megaease/easeagent-sdk-go/plugins/zipkin"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const testKind = "AgentTest"
+
+type (
+	testSpec struct {
+		plugins.BaseSpec `json:",inline"`
+
+		Value string `json:"value"`
+
+		closeErr   error         `json:"-"`
+		closeDelay time.Duration `json:"-"`
+		closed     *recorder     `json:"-"`
+		onClose    func()        `json:"-"`
+	}
+
+	testPlugin struct {
+		spec testSpec
+	}
+
+	// recorder records the names of closed plugins.
+	recorder struct {
+		mutex sync.Mutex
+		names []string
+	}
+
+	// memReporter buffers spans in memory until it's closed.
+	memReporter struct {
+		mutex   sync.Mutex
+		buffer  []model.SpanModel
+		flushed []model.SpanModel
+	}
+)
+
+func init() {
+	plugins.Register(&plugins.Constructor{
+		Kind: testKind,
+		DefaultSpec: func() plugins.Spec {
+			return testSpec{BaseSpec: plugins.BaseSpec{KindField: testKind}}
+		},
+		NewInstance: func(spec plugins.Spec) (plugins.Plugin, error) {
+			return &testPlugin{spec: spec.(testSpec)}, nil
+		},
+	})
+}
+
+func newTestSpec(name string, closed *recorder) testSpec {
+	return testSpec{
+		BaseSpec: plugins.BaseSpec{KindField: testKind, NameField: name},
+		closed:   closed,
+	}
+}
+
+func (s testSpec) Validate() error { return nil }
+
+func (p *testPlugin) Name() string { return p.spec.Name() }
+
+func (p *testPlugin) Close() error {
+	time.Sleep(p.spec.closeDelay)
+	if p.spec.onClose != nil {
+		p.spec.onClose()
+	}
+	if p.spec.closed != nil {
+		p.spec.closed.add(p.spec.Name())
+	}
+	return p.spec.closeErr
+}
+
+// WrapUserHandlerFunc sets the value of the plugin to the response header.
+func (p *testPlugin) WrapUserHandlerFunc(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Test", p.spec.Name()+"="+p.spec.Value)
+		fn(w, r)
+	}
+}
+
+func (r *recorder) add(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.names = append(r.names, name)
+}
+
+func (r *recorder) list() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string{}, r.names...)
+}
+
+func (r *memReporter) Send(s model.SpanModel) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.buffer = append(r.buffer, s)
+}
+
+func (r *memReporter) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.flushed = append(r.flushed, r.buffer...)
+	r.buffer = nil
+	return nil
+}
+
+func (r *memReporter) Flushed() []model.SpanModel {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.flushed
+}
+
+func newTestZipkinSpec(rep *memReporter) zipkin.Spec {
+	spec := zipkin.DefaultSpec().(zipkin.Spec)
+	spec.LocalHostport = ""
+	spec.Reporter = rep
+	return spec
+}
+
+func TestShutdownFlushesReporter(t *testing.T) {
+	rep := &memReporter{}
+	a, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithSpec(newTestZipkinSpec(rep)))
+	assert.Nil(t, err)
+
+	tracing := a.GetPlugin(zipkin.Name).(zipkin.Tracing)
+	tracing.StartSpan(nil, "test-span").Finish()
+	assert.Empty(t, rep.Flushed())
+
+	err = a.Shutdown(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, rep.Flushed(), 1)
+	assert.Equal(t, "test-span", rep.Flushed()[0].Name)
+}
+
+func TestShutdownClosesInReverseOrder(t *testing.T) {
+	closed := &recorder{}
+	first, second := newTestSpec("first", closed), newTestSpec("second", closed)
+	second.closeErr = fmt.Errorf("boom")
+	third := newTestSpec("third", closed)
+	third.closeErr = fmt.Errorf("bang")
+
+	a, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithSpec(first), WithSpec(second), WithSpec(third))
+	assert.Nil(t, err)
+
+	err = a.Close()
+	assert.Equal(t, []string{"third", "second", "first"}, closed.list())
+
+	var errs Errors
+	assert.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 2)
+	assert.Contains(t, err.Error(), "third")
+	assert.Contains(t, err.Error(), "second")
+
+	// Closing twice doesn't close plugins again.
+	a.Close()
+	assert.Len(t, closed.list(), 3)
+}
+
+func TestShutdownServesWhileClosing(t *testing.T) {
+	var status int
+	var a *Agent
+	spec := newTestSpec("deregister", nil)
+	spec.onClose = func() {
+		resp, err := http.Get("http://" + a.Addr().String() + "/health")
+		if assert.Nil(t, err) {
+			resp.Body.Close()
+			status = resp.StatusCode
+		}
+	}
+
+	a, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithSpec(spec))
+	assert.Nil(t, err)
+
+	// The plugins are closed before the agent server shuts down.
+	assert.Nil(t, a.Shutdown(context.Background()))
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	slow := newTestSpec("slow", nil)
+	slow.closeDelay = time.Second
+
+	a, err := NewWithOptions(WithAddress("127.0.0.1:0"), WithSpec(slow))
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = a.Shutdown(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestShutdownWaitsForInFlightRequests(t *testing.T) {
+	closed := &recorder{}
+	a, err := NewWithOptions(WithAddress(""), WithSpec(newTestSpec("test", closed)))
+	assert.Nil(t, err)
+
+	entered, done := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(a.WrapUserHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-done
+	})))
+	defer server.Close()
+
+	go http.Get(server.URL)
+	<-entered
+
+	shutdown := make(chan error)
+	go func() { shutdown <- a.Close() }()
+
+	// The plugins are not closed until the request is done.
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, closed.list())
+
+	close(done)
+	assert.Nil(t, <-shutdown)
+	assert.Equal(t, []string{"test"}, closed.list())
+}
+
+func TestListenFailure(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	closed := &recorder{}
+	a, err := NewWithOptions(WithAddress(listener.Addr().String()), WithSpec(newTestSpec("test", closed)))
+	assert.Nil(t, a)
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"test"}, closed.list())
+}
+
+func TestEmptyAddress(t *testing.T) {
+	a, err := NewWithOptions()
+	assert.Nil(t, err)
+	assert.Nil(t, a.Addr())
+	assert.Nil(t, a.Close())
+}
+
+func TestUnixListener(t *testing.T) {
+	sockFile := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", sockFile)
+	assert.Nil(t, err)
+
+	a, err := NewWithOptions(WithListener(listener))
+	assert.Nil(t, err)
+	defer a.Close()
+	assert.Equal(t, sockFile, a.Addr().String())
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", sockFile)
+			},
+		},
+	}
+	resp, err := client.Get("http://agent/health")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
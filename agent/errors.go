@@ -0,0 +1,58 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"errors"
+	"strings"
+)
+
+// Errors aggregates several errors into one.
+type Errors []error
+
+// Error returns all error messages joined by "; ".
+func (es Errors) Error() string {
+	msgs := make([]string, 0, len(es))
+	for _, err := range es {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the errors matches target.
+func (es Errors) Is(target error) bool {
+	for _, err := range es {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// appendErrors appends err to es, the aggregated errors are flattened.
+func appendErrors(es Errors, err error) Errors {
+	if err == nil {
+		return es
+	}
+	if errs, ok := err.(Errors); ok {
+		return append(es, errs...)
+	}
+
+	return append(es, err)
+}
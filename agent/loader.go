@@ -0,0 +1,490 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+	"github.com/megaease/easeagent-sdk-go/plugins/easemesh"
+	"github.com/megaease/easeagent-sdk-go/plugins/health"
+	"github.com/megaease/easeagent-sdk-go/plugins/zipkin"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+const defaultHTTPSourceTimeout = 5 * time.Second
+
+// configTypes are the types resolved from config values.
+var configTypes = []interface{}{Config{}, easemesh.Spec{}, zipkin.Spec{}}
+
+type (
+	// Source is a source of config values, the values are keyed by the flat
+	// config keys such as tracing.sample.rate, please see doc/about-config.md.
+	Source interface {
+		// Name returns the name of the source, which is used as the provenance of keys.
+		Name() string
+		// Load loads the values, it could return the valid values along with the error.
+		Load() (map[string]interface{}, error)
+	}
+
+	// Loader loads config values from sources, and merges them in the order
+	// of sources, the latter source takes precedence over the former ones.
+	Loader struct {
+		sources []Source
+	}
+
+	// Resolved is the config resolved by Loader.
+	Resolved struct {
+		Config *Config
+		// Values are the merged values of the keys.
+		Values map[string]interface{}
+		// Provenance maps the keys to the names of the sources which win them.
+		Provenance map[string]string
+		// Unknown are the sorted keys which are not used by any config.
+		Unknown []string
+		// Invalid are the keys whose values are in mismatched types in any source,
+		// which are skipped, so the values of the former sources win them.
+		Invalid []string
+	}
+
+	defaultsSource struct{}
+
+	fileSource struct {
+		file   string
+		format string
+	}
+
+	envSource struct {
+		lookup plugins.EnvLookup
+	}
+
+	httpSource struct {
+		url    string
+		client *http.Client
+	}
+)
+
+// NewLoader creates a Loader with sources in ascending precedence.
+func NewLoader(sources ...Source) *Loader {
+	return &Loader{sources: sources}
+}
+
+// DefaultLoader creates the Loader used by WithYAML, WithZipkinYAML and WithEaseMeshYAML,
+// it merges in the order of defaults, the YAML file and environment variables, so the keys
+// are overridden by environment variables such as EASEAGENT_TRACING_SAMPLE_RATE,
+// please see plugins.EnvKey.
+// @param  yamlFile string yaml file path, yamlFile="" means no YAML source.
+// @return *Loader
+func DefaultLoader(yamlFile string) *Loader {
+	sources := []Source{DefaultsSource()}
+	if yamlFile != "" {
+		sources = append(sources, YAMLFileSource(yamlFile))
+	}
+	sources = append(sources, EnvSource(os.LookupEnv))
+
+	return NewLoader(sources...)
+}
+
+// Load loads and merges the values of all sources, then resolves them to Config.
+// The failed sources and the values in mismatched types are skipped, and reported
+// together in the returned error along with the resolved config.
+func (l *Loader) Load() (*Resolved, error) {
+	resolved := &Resolved{
+		Values:     map[string]interface{}{},
+		Provenance: map[string]string{},
+	}
+
+	var errs Errors
+	for _, source := range l.sources {
+		values, err := source.Load()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("load config from %s failed: %v", source.Name(), err))
+		}
+
+		invalid, err := checkTypes(values)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("load config from %s failed: %v", source.Name(), err))
+		}
+		for _, key := range invalid {
+			delete(values, key)
+			if !slices.Contains(resolved.Invalid, key) {
+				resolved.Invalid = append(resolved.Invalid, key)
+			}
+		}
+
+		for key, value := range values {
+			resolved.Values[key] = value
+			resolved.Provenance[key] = source.Name()
+		}
+	}
+
+	resolved.Unknown = unknownKeys(resolved.Values)
+
+	config, err := resolveConfig(resolved.Values, l.envLookups())
+	errs = appendErrors(errs, err)
+	resolved.Config = config
+
+	if len(errs) != 0 {
+		return resolved, errs
+	}
+
+	return resolved, nil
+}
+
+// envLookups returns the lookups of the environment variable sources.
+func (l *Loader) envLookups() []plugins.EnvLookup {
+	var lookups []plugins.EnvLookup
+	for _, source := range l.sources {
+		if es, ok := source.(*envSource); ok {
+			lookups = append(lookups, es.lookup)
+		}
+	}
+
+	return lookups
+}
+
+// files returns the files loaded by the sources.
+func (l *Loader) files() []string {
+	var files []string
+	for _, source := range l.sources {
+		if fs, ok := source.(*fileSource); ok {
+			files = append(files, fs.file)
+		}
+	}
+
+	return files
+}
+
+// unknownKeys returns the sorted keys of values which are not used by any config.
+func unknownKeys(values map[string]interface{}) []string {
+	known := map[string]bool{"name": true, "kind": true, "plugins": true}
+	for _, v := range configTypes {
+		for _, key := range plugins.Keys(v) {
+			known[key] = true
+		}
+	}
+
+	var unknown []string
+	for key := range values {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+
+	return unknown
+}
+
+// checkTypes checks the types of all values, and returns the sorted keys in
+// mismatched types along with the error reporting all of them.
+func checkTypes(values map[string]interface{}) ([]string, error) {
+	keys := maps.Keys(values)
+	sort.Strings(keys)
+
+	var invalid []string
+	var errs Errors
+	for _, key := range keys {
+		buff, err := json.Marshal(map[string]interface{}{key: values[key]})
+		if err != nil {
+			invalid = append(invalid, key)
+			errs = append(errs, fmt.Errorf("marshal %s failed: %v", key, err))
+			continue
+		}
+
+		for _, v := range configTypes {
+			err := json.Unmarshal(buff, reflect.New(reflect.TypeOf(v)).Interface())
+			if err == nil {
+				continue
+			}
+
+			invalid = append(invalid, key)
+			if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+				errs = append(errs, fmt.Errorf("invalid %s: want %s, got %s %v", key, typeErr.Type, typeErr.Value, values[key]))
+			} else {
+				errs = append(errs, fmt.Errorf("invalid %s: %v", key, err))
+			}
+			break
+		}
+	}
+
+	if len(errs) != 0 {
+		return invalid, errs
+	}
+
+	return nil, nil
+}
+
+// UnmarshalJSON unmarshals the config, the plugin specs are created by their
+// kinds, please see plugins.NewSpecFromJSON. It reports all invalid specs.
+func (c *Config) UnmarshalJSON(buff []byte) error {
+	type config Config
+	raw := struct {
+		*config
+		Plugins []json.RawMessage `json:"plugins"`
+	}{config: (*config)(c)}
+
+	if err := json.Unmarshal(buff, &raw); err != nil {
+		return err
+	}
+
+	var errs Errors
+	for i, specJSON := range raw.Plugins {
+		spec, err := plugins.NewSpecFromJSON(specJSON)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("plugins[%d]: %v", i, err))
+			continue
+		}
+		c.Plugins = append(c.Plugins, spec)
+	}
+
+	if len(errs) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// resolveConfig resolves the values to Config with the specs of health,
+// easemesh and zipkin, which are the same as WithYAML, and the specs of
+// the plugins list. The spec in the list replaces the one of the same name.
+// The specs of the list are overridden by the environment variables of lookups
+// in the form of EASEAGENT_<NAME>_<KEY>, please see pluginEnvLookup.
+func resolveConfig(values map[string]interface{}, lookups []plugins.EnvLookup) (*Config, error) {
+	buff, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("marshal config values failed: %v", err)
+	}
+
+	config := &Config{}
+	if err := json.Unmarshal(buff, config); err != nil {
+		return nil, fmt.Errorf("unmarshal config values to %T failed: %v", config, err)
+	}
+
+	var easeMeshSpec easemesh.Spec
+	if err := json.Unmarshal(buff, &easeMeshSpec); err != nil {
+		return nil, fmt.Errorf("unmarshal config values to %T failed: %v", easeMeshSpec, err)
+	}
+	easeMeshSpec.KindField = easemesh.Kind
+	easeMeshSpec.NameField = easemesh.Name
+
+	var zipkinSpec zipkin.Spec
+	if err := json.Unmarshal(buff, &zipkinSpec); err != nil {
+		return nil, fmt.Errorf("unmarshal config values to %T failed: %v", zipkinSpec, err)
+	}
+	zipkinSpec.KindField = zipkin.Kind
+	zipkinSpec.NameField = zipkin.Name
+
+	var errs Errors
+	for i, spec := range config.Plugins {
+		for _, lookup := range lookups {
+			spec, err = plugins.ApplyEnvToSpec(spec, pluginEnvLookup(spec.Name(), lookup))
+			if err != nil {
+				// NOTE: The errors name the variables without the prefix of the plugin.
+				msg := strings.ReplaceAll(err.Error(), "invalid "+plugins.EnvPrefix, "invalid "+pluginEnvPrefix(spec.Name()))
+				errs = append(errs, fmt.Errorf("plugins[%s]: %s", spec.Name(), msg))
+			}
+		}
+		config.Plugins[i] = spec
+	}
+
+	specs := []plugins.Spec{health.DefaultSpec(), easeMeshSpec, zipkinSpec}
+	for _, spec := range config.Plugins {
+		i := slices.IndexFunc(specs, func(s plugins.Spec) bool { return s.Name() == spec.Name() })
+		if i < 0 {
+			specs = append(specs, spec)
+		} else {
+			specs[i] = spec
+		}
+	}
+	config.Plugins = specs
+
+	if len(errs) != 0 {
+		return config, errs
+	}
+
+	return config, nil
+}
+
+// pluginEnvLookup returns the lookup of the plugin in the plugins list, the config keys
+// are prefixed with the name of the plugin, for example the key consul.address of
+// the plugin consul is EASEAGENT_CONSUL_CONSUL_ADDRESS.
+func pluginEnvLookup(name string, lookup plugins.EnvLookup) plugins.EnvLookup {
+	prefix := pluginEnvPrefix(name)
+	return func(key string) (string, bool) {
+		return lookup(prefix + strings.TrimPrefix(key, plugins.EnvPrefix))
+	}
+}
+
+// pluginEnvPrefix returns the prefix of the environment variables of the plugin.
+func pluginEnvPrefix(name string) string {
+	return plugins.EnvKey(name) + "_"
+}
+
+// specValues returns the values of the spec keyed by config keys except the ones of BaseSpec.
+func specValues(spec interface{}) (map[string]interface{}, error) {
+	buff, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %T failed: %v", spec, err)
+	}
+
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(buff, &values); err != nil {
+		return nil, fmt.Errorf("unmarshal %T to map failed: %v", spec, err)
+	}
+	delete(values, "name")
+	delete(values, "kind")
+
+	return values, nil
+}
+
+// DefaultsSource returns the source of default values, which are the same as
+// the defaults of WithYAML("", "").
+func DefaultsSource() Source {
+	return defaultsSource{}
+}
+
+func (s defaultsSource) Name() string { return "defaults" }
+
+func (s defaultsSource) Load() (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, spec := range []interface{}{easemesh.DefaultSpec(), zipkin.NewConsoleReportSpec("")} {
+		specValues, err := specValues(spec)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range specValues {
+			values[key] = value
+		}
+	}
+
+	return values, nil
+}
+
+// YAMLFileSource returns the source of the YAML file.
+func YAMLFileSource(file string) Source {
+	return &fileSource{file: file, format: "yaml"}
+}
+
+// JSONFileSource returns the source of the JSON file.
+func JSONFileSource(file string) Source {
+	return &fileSource{file: file, format: "json"}
+}
+
+func (s *fileSource) Name() string { return s.format + ":" + s.file }
+
+func (s *fileSource) Load() (map[string]interface{}, error) {
+	var buff []byte
+	var err error
+	if s.format == "yaml" {
+		buff, err = yamlToJSON(s.file)
+	} else {
+		buff, err = ioutil.ReadFile(s.file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalValues(buff)
+}
+
+// EnvSource returns the source of environment variables, please see plugins.EnvKey
+// for the names. The values are parsed in the types of keys.
+// @param  lookup plugins.EnvLookup, os.LookupEnv is the default one.
+// @return Source
+func EnvSource(lookup plugins.EnvLookup) Source {
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	return &envSource{lookup: lookup}
+}
+
+func (s *envSource) Name() string { return "env" }
+
+func (s *envSource) Load() (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+
+	var errs Errors
+	for _, v := range configTypes {
+		envValues, err := plugins.EnvValues(v, s.lookup)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for key, value := range envValues {
+			values[key] = value
+		}
+	}
+
+	if len(errs) != 0 {
+		return values, errs
+	}
+
+	return values, nil
+}
+
+// HTTPSource returns the source of the remote HTTP endpoint, which responds
+// the config values in a JSON object.
+// @param  url string the url of the endpoint.
+// @param  client *http.Client, nil means the client with the timeout of 5s.
+// @return Source
+func HTTPSource(url string, client *http.Client) Source {
+	if client == nil {
+		client = &http.Client{Timeout: defaultHTTPSourceTimeout}
+	}
+	return &httpSource{url: url, client: client}
+}
+
+func (s *httpSource) Name() string { return "http:" + s.url }
+
+func (s *httpSource) Load() (map[string]interface{}, error) {
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("get %s failed: %v", s.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s failed: status code %d", s.url, resp.StatusCode)
+	}
+
+	buff, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body of %s failed: %v", s.url, err)
+	}
+
+	return unmarshalValues(buff)
+}
+
+func unmarshalValues(buff []byte) (map[string]interface{}, error) {
+	var values map[string]interface{}
+	if err := json.Unmarshal(buff, &values); err != nil {
+		return nil, fmt.Errorf("unmarshal %s to map failed: %v", buff, err)
+	}
+	if values == nil {
+		return nil, fmt.Errorf("config values are empty")
+	}
+
+	return values, nil
+}
@@ -0,0 +1,146 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/megaease/easeagent-sdk-go/plugins/easemesh"
+	"github.com/megaease/easeagent-sdk-go/plugins/health"
+	"github.com/megaease/easeagent-sdk-go/plugins/resilience"
+	"github.com/megaease/easeagent-sdk-go/plugins/zipkin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoaderPrecedence(t *testing.T) {
+	yamlFile := writeYAML(t, "address: :9900\nserviceName: yaml-service\ntracing.sample.rate: 0.1\nagentType: yaml\n")
+
+	jsonFile := filepath.Join(t.TempDir(), "agent.json")
+	assert.Nil(t, ioutil.WriteFile(jsonFile, []byte(`{"serviceName":"json-service","tracing.sample.rate":0.2}`), 0o644))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tracing.sample.rate":0.3,"tracing.id128bit":true}`))
+	}))
+	defer server.Close()
+
+	env := func(key string) (string, bool) {
+		if key == "EASEAGENT_TRACING_SAMPLE_RATE" {
+			return "0.4", true
+		}
+		return "", false
+	}
+
+	loader := NewLoader(DefaultsSource(), YAMLFileSource(yamlFile), JSONFileSource(jsonFile),
+		HTTPSource(server.URL, nil), EnvSource(env))
+	resolved, err := loader.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{yamlFile, jsonFile}, loader.files())
+
+	assert.Equal(t, ":9900", resolved.Config.Address)
+	assert.Len(t, resolved.Config.Plugins, 3)
+	assert.Equal(t, health.Kind, resolved.Config.Plugins[0].Kind())
+	assert.Equal(t, "yaml", resolved.Config.Plugins[1].(easemesh.Spec).AgentType)
+
+	spec := resolved.Config.Plugins[2].(zipkin.Spec)
+	assert.Equal(t, "json-service", spec.ServiceName)
+	assert.Equal(t, 0.4, spec.SampleRate)
+	assert.True(t, spec.ID128Bit)
+	assert.True(t, spec.EnableTracing)
+	assert.Equal(t, zipkin.Name, spec.Name())
+
+	assert.Equal(t, "yaml:"+yamlFile, resolved.Provenance["address"])
+	assert.Equal(t, "json:"+jsonFile, resolved.Provenance["serviceName"])
+	assert.Equal(t, "http:"+server.URL, resolved.Provenance["tracing.id128bit"])
+	assert.Equal(t, "env", resolved.Provenance["tracing.sample.rate"])
+	assert.Equal(t, "defaults", resolved.Provenance["tracing.enable"])
+}
+
+func TestLoaderErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	// The failed sources are skipped.
+	resolved, err := NewLoader(DefaultsSource(), YAMLFileSource("not-exist.yml"), HTTPSource(server.URL, nil)).Load()
+	assert.NotNil(t, err)
+	assert.Len(t, err.(Errors), 2)
+	assert.Equal(t, "", resolved.Config.Plugins[2].(zipkin.Spec).OutputServerURL)
+	assert.Equal(t, "defaults", resolved.Provenance["reporter.output.server"])
+
+	// The values in mismatched types are skipped.
+	yamlFile := writeYAML(t, "tracing.sample.rate: high\n")
+	resolved, err = NewLoader(DefaultsSource(), YAMLFileSource(yamlFile)).Load()
+	assert.EqualError(t, err, "load config from yaml:"+yamlFile+" failed: invalid tracing.sample.rate: want float64, got string high")
+	assert.Equal(t, []string{"tracing.sample.rate"}, resolved.Invalid)
+	assert.Equal(t, 1.0, resolved.Config.Plugins[2].(zipkin.Spec).SampleRate)
+	assert.Equal(t, "defaults", resolved.Provenance["tracing.sample.rate"])
+}
+
+func TestLoaderPluginsEnv(t *testing.T) {
+	yamlFile := writeYAML(t, `plugins:
+- kind: Resilience
+  name: my-resilience
+  resilience.retry.maxAttempts: 2
+`)
+
+	env := func(key string) (string, bool) {
+		switch key {
+		case "EASEAGENT_MY_RESILIENCE_RESILIENCE_RETRY_MAX_ATTEMPTS":
+			return "3", true
+		case "EASEAGENT_MY_RESILIENCE_RESILIENCE_TIME_LIMITER_TIMEOUT":
+			return "100ms", true
+		case "EASEAGENT_RESILIENCE_RETRY_MAX_ATTEMPTS":
+			return "4", true
+		}
+		return "", false
+	}
+
+	resolved, err := NewLoader(DefaultsSource(), YAMLFileSource(yamlFile), EnvSource(env)).Load()
+	assert.Nil(t, err)
+	spec := resolved.Config.Plugins[3].(resilience.Spec)
+	assert.Equal(t, "my-resilience", spec.Name())
+	assert.Equal(t, 3, spec.MaxAttempts)
+	assert.Equal(t, "100ms", spec.Timeout)
+
+	// The invalid values are reported, and the others are kept.
+	env = func(key string) (string, bool) {
+		if key == "EASEAGENT_MY_RESILIENCE_RESILIENCE_RETRY_MAX_ATTEMPTS" {
+			return "many", true
+		}
+		return "", false
+	}
+	resolved, err = NewLoader(DefaultsSource(), YAMLFileSource(yamlFile), EnvSource(env)).Load()
+	assert.Contains(t, err.Error(), "plugins[my-resilience]: invalid EASEAGENT_MY_RESILIENCE_RESILIENCE_RETRY_MAX_ATTEMPTS")
+	assert.Equal(t, 2, resolved.Config.Plugins[3].(resilience.Spec).MaxAttempts)
+}
+
+func TestWithYAMLFallback(t *testing.T) {
+	yamlFile := writeYAML(t, "serviceName: yaml-service\ntracing.sample.rate: high\n")
+
+	config := newConfig(WithYAML(yamlFile, "127.0.0.1:8080"))
+	assert.Len(t, config.errs, 1)
+	assert.Equal(t, []string{yamlFile}, config.yamlFiles)
+
+	spec := findZipkinSpec(config)
+	assert.Equal(t, "default-service", spec.ServiceName)
+	assert.Equal(t, "127.0.0.1:8080", spec.LocalHostport)
+}
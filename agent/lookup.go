@@ -0,0 +1,101 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+)
+
+// PluginAs returns the plugin by name as T. It returns false if the agent is nil,
+// the plugin is not found, or the plugin is not a T.
+func PluginAs[T any](a *Agent, name string) (T, bool) {
+	var zero T
+	if a == nil {
+		return zero, false
+	}
+
+	plug := a.GetPlugin(name)
+	if plug == nil {
+		return zero, false
+	}
+
+	t, ok := plug.(T)
+	return t, ok
+}
+
+// MustPlugin is like PluginAs but panics if the plugin is unavailable.
+func MustPlugin[T any](a *Agent, name string) T {
+	t, ok := PluginAs[T](a, name)
+	if !ok {
+		panic(fmt.Errorf("plugin %s as %v not found", name, reflect.TypeOf((*T)(nil)).Elem()))
+	}
+
+	return t
+}
+
+// PluginOfKindAs returns the first loaded plugin of the kind as T.
+// It returns false if the agent is nil, or there is no such plugin.
+func PluginOfKindAs[T any](a *Agent, kind string) (T, bool) {
+	var zero T
+	if a == nil {
+		return zero, false
+	}
+
+	for _, plug := range a.PluginsOfKind(kind) {
+		if t, ok := plug.(T); ok {
+			return t, true
+		}
+	}
+
+	return zero, false
+}
+
+// PluginsAs returns all plugins which are T in load order,
+// T is usually a capability interface such as plugins.UserClientWrapper.
+func PluginsAs[T any](a *Agent) []T {
+	if a == nil {
+		return nil
+	}
+
+	var result []T
+	for _, plug := range a.pluginSet().plugins() {
+		if t, ok := plug.(T); ok {
+			result = append(result, t)
+		}
+	}
+
+	return result
+}
+
+// PluginsOfKind returns all plugins of the kind in load order.
+func (a *Agent) PluginsOfKind(kind string) []plugins.Plugin {
+	if a == nil {
+		return nil
+	}
+
+	var result []plugins.Plugin
+	for _, entry := range a.pluginSet().entries {
+		if entry.spec.Kind() == kind {
+			result = append(result, entry.plugin)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,79 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"testing"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+	"github.com/megaease/easeagent-sdk-go/plugins/health"
+	"github.com/megaease/easeagent-sdk-go/plugins/zipkin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPluginAs(t *testing.T) {
+	tracing, ok := PluginAs[zipkin.Tracing](nil, zipkin.Name)
+	assert.False(t, ok)
+	assert.Nil(t, tracing)
+
+	a, err := NewWithOptions(WithSpec(newTestZipkinSpec(&memReporter{})), WithSpec(newTestSpec("test", nil)))
+	assert.Nil(t, err)
+	defer a.Close()
+
+	tracing, ok = PluginAs[zipkin.Tracing](a, zipkin.Name)
+	assert.True(t, ok)
+	assert.NotNil(t, tracing)
+
+	_, ok = PluginAs[zipkin.Tracing](a, "test")
+	assert.False(t, ok)
+	_, ok = PluginAs[zipkin.Tracing](a, "none")
+	assert.False(t, ok)
+
+	assert.NotNil(t, MustPlugin[zipkin.Tracing](a, zipkin.Name))
+	assert.PanicsWithError(t, "plugin test as zipkin.Tracing not found", func() {
+		MustPlugin[zipkin.Tracing](a, "test")
+	})
+}
+
+func TestPluginsByKindAndCapability(t *testing.T) {
+	_, ok := PluginOfKindAs[zipkin.Tracing](nil, zipkin.Kind)
+	assert.False(t, ok)
+	assert.Nil(t, PluginsAs[plugins.UserClientWrapper](nil))
+	assert.Nil(t, (*Agent)(nil).PluginsOfKind(zipkin.Kind))
+
+	a, err := NewWithOptions(
+		WithSpec(newTestSpec("first", nil)),
+		WithSpec(newTestZipkinSpec(&memReporter{})),
+		WithSpec(newTestSpec("second", nil)),
+	)
+	assert.Nil(t, err)
+	defer a.Close()
+
+	tracing, ok := PluginOfKindAs[zipkin.Tracing](a, zipkin.Kind)
+	assert.True(t, ok)
+	assert.Same(t, a.GetPlugin(zipkin.Name), tracing)
+
+	testPlugins := a.PluginsOfKind(testKind)
+	assert.Len(t, testPlugins, 2)
+	assert.Equal(t, "first", testPlugins[0].Name())
+	assert.Equal(t, "second", testPlugins[1].Name())
+	assert.Len(t, a.PluginsOfKind(health.Kind), 1)
+
+	assert.Len(t, PluginsAs[plugins.UserClientWrapper](a), 1)
+	assert.Len(t, PluginsAs[plugins.UserHandlerFuncWrapper](a), 3)
+	assert.Len(t, PluginsAs[plugins.AgentHandler](a), 2)
+}
@@ -0,0 +1,129 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+)
+
+type (
+	// pluginEntry is a loaded plugin with its spec.
+	pluginEntry struct {
+		spec   plugins.Spec
+		plugin plugins.Plugin
+	}
+
+	// pluginSet is an immutable snapshot of the loaded plugins,
+	// it's replaced as a whole whenever plugins change.
+	pluginSet struct {
+		generation uint64
+		entries    []*pluginEntry
+
+		// refs counts the users of the set, the retired set is drained
+		// after all of them released it.
+		refs      int64
+		retired   int32
+		drained   chan struct{}
+		drainOnce sync.Once
+	}
+)
+
+// sortEntries sorts the entries in load order, please see plugins.SortSpecs.
+func sortEntries(entries []*pluginEntry) ([]*pluginEntry, error) {
+	specs := make([]plugins.Spec, 0, len(entries))
+	byName := make(map[string]*pluginEntry, len(entries))
+	for _, entry := range entries {
+		specs = append(specs, entry.spec)
+		byName[entry.spec.Name()] = entry
+	}
+
+	specs, err := plugins.SortSpecs(specs)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]*pluginEntry, 0, len(entries))
+	for _, spec := range specs {
+		sorted = append(sorted, byName[spec.Name()])
+	}
+
+	return sorted, nil
+}
+
+func newPluginSet(generation uint64, entries []*pluginEntry) *pluginSet {
+	return &pluginSet{
+		generation: generation,
+		entries:    entries,
+		drained:    make(chan struct{}),
+	}
+}
+
+func (s *pluginSet) plugins() []plugins.Plugin {
+	plugs := make([]plugins.Plugin, 0, len(s.entries))
+	for _, entry := range s.entries {
+		plugs = append(plugs, entry.plugin)
+	}
+
+	return plugs
+}
+
+func (s *pluginSet) get(name string) *pluginEntry {
+	for _, entry := range s.entries {
+		if entry.spec.Name() == name {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+func (s *pluginSet) specs() []plugins.Spec {
+	specs := make([]plugins.Spec, 0, len(s.entries))
+	for _, entry := range s.entries {
+		specs = append(specs, entry.spec)
+	}
+
+	return specs
+}
+
+func (s *pluginSet) acquire() {
+	atomic.AddInt64(&s.refs, 1)
+}
+
+func (s *pluginSet) release() {
+	if atomic.AddInt64(&s.refs, -1) == 0 && atomic.LoadInt32(&s.retired) == 1 {
+		s.drain()
+	}
+}
+
+// retire marks the set retired, the drained channel is closed
+// once no one is using the set.
+func (s *pluginSet) retire() {
+	atomic.StoreInt32(&s.retired, 1)
+	if atomic.LoadInt64(&s.refs) == 0 {
+		s.drain()
+	}
+}
+
+func (s *pluginSet) drain() {
+	s.drainOnce.Do(func() {
+		close(s.drained)
+	})
+}
@@ -0,0 +1,147 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"fmt"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+)
+
+// AddPlugin creates a plugin by the spec and adds it to the agent in load order.
+// The wrapped handlers and clients pick up the plugin without being re-wrapped.
+func (a *Agent) AddPlugin(spec plugins.Spec) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.closed {
+		return fmt.Errorf("agent closed")
+	}
+
+	old := a.pluginSet()
+	if old.get(spec.Name()) != nil {
+		return fmt.Errorf("plugin %s already exists", spec.Name())
+	}
+
+	_, err := plugins.SortSpecs(append(old.specs(), spec))
+	if err != nil {
+		return err
+	}
+
+	plug, err := plugins.New(spec)
+	if err != nil {
+		return err
+	}
+
+	entries, _ := sortEntries(append(append([]*pluginEntry{}, old.entries...), &pluginEntry{spec: spec, plugin: plug}))
+	a.swapPlugins(entries, nil)
+
+	return nil
+}
+
+// RemovePlugin removes the plugin by name, the plugin is closed after
+// all in-flight requests using it finish.
+// It returns error if any other plugin depends on the plugin.
+func (a *Agent) RemovePlugin(name string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.closed {
+		return fmt.Errorf("agent closed")
+	}
+
+	old := a.pluginSet()
+	entry := old.get(name)
+	if entry == nil {
+		return fmt.Errorf("plugin %s not found", name)
+	}
+
+	entries := make([]*pluginEntry, 0, len(old.entries)-1)
+	for _, e := range old.entries {
+		if e != entry {
+			entries = append(entries, e)
+		}
+	}
+
+	entries, err := sortEntries(entries)
+	if err != nil {
+		return err
+	}
+
+	a.swapPlugins(entries, []*pluginEntry{entry})
+
+	return nil
+}
+
+// ReplacePlugin replaces the plugin which has the same name with the spec.
+// The plugin is reloaded in place if it's plugins.Reloader and the kind is unchanged,
+// otherwise the new one is created and the old one is closed after all in-flight
+// requests using it finish.
+func (a *Agent) ReplacePlugin(spec plugins.Spec) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.closed {
+		return fmt.Errorf("agent closed")
+	}
+
+	old := a.pluginSet()
+	oldEntry := old.get(spec.Name())
+	if oldEntry == nil {
+		return fmt.Errorf("plugin %s not found", spec.Name())
+	}
+
+	newEntry := &pluginEntry{spec: spec, plugin: oldEntry.plugin}
+	entries := make([]*pluginEntry, 0, len(old.entries))
+	for _, e := range old.entries {
+		if e == oldEntry {
+			e = newEntry
+		}
+		entries = append(entries, e)
+	}
+
+	entries, err := sortEntries(entries)
+	if err != nil {
+		return err
+	}
+
+	var retired []*pluginEntry
+
+	reloader, ok := oldEntry.plugin.(plugins.Reloader)
+	if ok && oldEntry.spec.Kind() == spec.Kind() {
+		err := spec.Validate()
+		if err != nil {
+			return fmt.Errorf("validate %T failed: %v", spec, err)
+		}
+
+		err = reloader.Reload(spec)
+		if err != nil {
+			return fmt.Errorf("reload plugin %s failed: %v", spec.Name(), err)
+		}
+	} else {
+		plug, err := plugins.New(spec)
+		if err != nil {
+			return err
+		}
+		newEntry.plugin = plug
+		retired = append(retired, oldEntry)
+	}
+
+	a.swapPlugins(entries, retired)
+
+	return nil
+}
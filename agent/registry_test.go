@@ -0,0 +1,127 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/megaease/easeagent-sdk-go/plugins/zipkin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddRemoveReplacePlugin(t *testing.T) {
+	closed := &recorder{}
+	a, err := NewWithOptions()
+	assert.Nil(t, err)
+	defer a.Close()
+
+	handler := a.WrapUserHandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func() []string {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Header().Values("X-Test")
+	}
+	assert.Empty(t, serve())
+
+	assert.Nil(t, a.AddPlugin(newTestSpec("first", closed)))
+	assert.Nil(t, a.AddPlugin(newTestSpec("second", closed)))
+	assert.NotNil(t, a.AddPlugin(newTestSpec("first", closed)))
+	assert.Equal(t, []string{"second=", "first="}, serve())
+
+	spec := newTestSpec("first", closed)
+	spec.Value = "new"
+	assert.Nil(t, a.ReplacePlugin(spec))
+	assert.NotNil(t, a.ReplacePlugin(newTestSpec("none", closed)))
+	assert.Equal(t, []string{"second=", "first=new"}, serve())
+
+	assert.Nil(t, a.RemovePlugin("second"))
+	assert.NotNil(t, a.RemovePlugin("second"))
+	assert.Equal(t, []string{"first=new"}, serve())
+
+	assert.Eventually(t, func() bool {
+		return len(closed.list()) == 2
+	}, time.Second, time.Millisecond)
+	assert.ElementsMatch(t, []string{"first", "second"}, closed.list())
+}
+
+func TestReplaceReloader(t *testing.T) {
+	a, err := NewWithOptions(WithSpec(newTestZipkinSpec(&memReporter{})))
+	assert.Nil(t, err)
+	defer a.Close()
+
+	tracing := a.GetPlugin(zipkin.Name)
+	spec := newTestZipkinSpec(&memReporter{})
+	spec.SampleRate = 0.5
+	assert.Nil(t, a.ReplacePlugin(spec))
+	assert.Same(t, tracing, a.GetPlugin(zipkin.Name))
+
+	spec.EnableBasicAuth = true
+	assert.NotNil(t, a.ReplacePlugin(spec))
+}
+
+func TestConcurrentPluginChanges(t *testing.T) {
+	a, err := NewWithOptions()
+	assert.Nil(t, err)
+	defer a.Close()
+
+	handler := a.WrapUserHandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	client := a.WrapUserClient(&http.Client{Transport: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})})
+
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+				a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+				req := a.WrapHTTPRequest(context.Background(), httptest.NewRequest(http.MethodGet, "http://test/", nil))
+				resp, err := client.Do(req)
+				if assert.Nil(t, err) {
+					resp.Body.Close()
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, a.AddPlugin(newTestSpec("test", nil)))
+		assert.Nil(t, a.ReplacePlugin(newTestSpec("test", nil)))
+		assert.Nil(t, a.RemovePlugin("test"))
+	}
+	close(stop)
+	wg.Wait()
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,216 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+)
+
+// Reload applies the plugins of the new config.
+// The unchanged plugins are kept, the changed ones are reloaded in place if they
+// are plugins.Reloader, otherwise they are rebuilt and swapped atomically.
+// The removed and replaced plugins are closed after all in-flight requests using them finish.
+// An invalid config is rejected and the old one is kept.
+// NOTE: The agent server is not reloaded, so Address and Listener are ignored.
+// The plugins added or replaced at runtime are also overridden by the config.
+func (a *Agent) Reload(config *Config) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.closed {
+		return fmt.Errorf("agent closed")
+	}
+
+	specs, err := resolveSpecs(config)
+	if err != nil {
+		return err
+	}
+
+	var errs Errors
+	for _, spec := range specs {
+		err := spec.Validate()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("validate plugin %s failed: %v", spec.Name(), err))
+		}
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+
+	old := a.pluginSet()
+
+	var entries, created, reloaded []*pluginEntry
+	kept := map[*pluginEntry]struct{}{}
+	for _, spec := range specs {
+		oldEntry := old.get(spec.Name())
+		if oldEntry != nil && oldEntry.spec.Kind() == spec.Kind() {
+			if reflect.DeepEqual(oldEntry.spec, spec) {
+				entries = append(entries, oldEntry)
+				kept[oldEntry] = struct{}{}
+				continue
+			}
+
+			if _, ok := oldEntry.plugin.(plugins.Reloader); ok {
+				entry := &pluginEntry{spec: spec, plugin: oldEntry.plugin}
+				entries = append(entries, entry)
+				reloaded = append(reloaded, entry)
+				kept[oldEntry] = struct{}{}
+				continue
+			}
+		}
+
+		plug, err := plugins.New(spec)
+		if err != nil {
+			closePlugins(created)
+			return fmt.Errorf("create plugin %s failed: %v", spec.Name(), err)
+		}
+		entry := &pluginEntry{spec: spec, plugin: plug}
+		entries = append(entries, entry)
+		created = append(created, entry)
+	}
+
+	for i, entry := range reloaded {
+		err := entry.plugin.(plugins.Reloader).Reload(entry.spec)
+		if err == nil {
+			continue
+		}
+
+		// Roll back the reloaded plugins to keep the old config.
+		for _, entry := range reloaded[:i] {
+			oldSpec := old.get(entry.spec.Name()).spec
+			rollbackErr := entry.plugin.(plugins.Reloader).Reload(oldSpec)
+			if rollbackErr != nil {
+				log.Printf("roll back plugin %s failed: %v", entry.spec.Name(), rollbackErr)
+			}
+		}
+		closePlugins(created)
+		return fmt.Errorf("reload plugin %s failed: %v", entry.spec.Name(), err)
+	}
+
+	var retired []*pluginEntry
+	for _, entry := range old.entries {
+		if _, ok := kept[entry]; !ok {
+			retired = append(retired, entry)
+		}
+	}
+
+	a.swapPlugins(entries, retired)
+
+	return nil
+}
+
+// swapPlugins stores the new plugin set, the retired plugins are closed
+// after the old set is drained. The caller must hold the mutex.
+func (a *Agent) swapPlugins(entries, retired []*pluginEntry) {
+	old := a.pluginSet()
+	a.plugins.Store(newPluginSet(old.generation+1, entries))
+	old.retire()
+
+	if len(retired) == 0 {
+		return
+	}
+
+	go func() {
+		<-old.drained
+		for _, err := range closePlugins(retired) {
+			log.Printf("%v", err)
+		}
+	}()
+}
+
+// reloadOptions reloads the config built by the options of NewWithOptions,
+// the config is rejected if any option failed to load it.
+func (a *Agent) reloadOptions() error {
+	config := newConfig(a.options...)
+	if config.strict {
+		err := config.validate()
+		if err != nil {
+			return err
+		}
+	} else if len(config.errs) != 0 {
+		return Errors(config.errs)
+	}
+
+	return a.Reload(config)
+}
+
+// watch reloads the config on SIGHUP, and on changes of the YAML files
+// if the interval is positive. The contents are the loaded ones of the files.
+func (a *Agent) watch(yamlFiles []string, contents [][]byte, interval time.Duration) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	var ticker *time.Ticker
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		tick = ticker.C
+	}
+
+	go func() {
+		defer signal.Stop(sighup)
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+
+		for {
+			select {
+			case <-a.watchStop:
+				return
+			case <-sighup:
+				contents = readFiles(yamlFiles)
+			case <-tick:
+				newContents := readFiles(yamlFiles)
+				if reflect.DeepEqual(contents, newContents) {
+					continue
+				}
+				contents = newContents
+			}
+
+			err := a.reloadOptions()
+			if err != nil {
+				log.Printf("reload config failed: %v, keep the old config", err)
+				continue
+			}
+			log.Printf("reload config succeeded")
+		}
+	}()
+}
+
+func readFiles(files []string) [][]byte {
+	contents := make([][]byte, 0, len(files))
+	for _, file := range files {
+		buff, err := ioutil.ReadFile(file)
+		if err != nil {
+			// NOTE: Nil content stands for unreadable file,
+			// the reload is triggered after the file becomes readable.
+			buff = nil
+		}
+		contents = append(contents, buff)
+	}
+
+	return contents
+}
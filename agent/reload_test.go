@@ -0,0 +1,169 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+	"github.com/megaease/easeagent-sdk-go/plugins/zipkin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *testing.T) {
+	closed := &recorder{}
+	rep := &memReporter{}
+	zipkinSpec := newTestZipkinSpec(rep)
+	a, err := New(&Config{
+		Plugins: []plugins.Spec{
+			newTestSpec("kept", closed),
+			newTestSpec("changed", closed),
+			newTestSpec("removed", closed),
+			zipkinSpec,
+		},
+	})
+	assert.Nil(t, err)
+	defer a.Close()
+
+	kept, changed, tracing := a.GetPlugin("kept"), a.GetPlugin("changed"), a.GetPlugin(zipkin.Name)
+
+	changedSpec := newTestSpec("changed", closed)
+	changedSpec.Value = "new"
+	zipkinSpec.SampleRate = 0.5
+	err = a.Reload(&Config{
+		Plugins: []plugins.Spec{
+			newTestSpec("kept", closed),
+			changedSpec,
+			newTestSpec("added", closed),
+			zipkinSpec,
+		},
+	})
+	assert.Nil(t, err)
+
+	assert.Same(t, kept, a.GetPlugin("kept"))
+	assert.NotSame(t, changed, a.GetPlugin("changed"))
+	assert.Nil(t, a.GetPlugin("removed"))
+	assert.NotNil(t, a.GetPlugin("added"))
+	// Zipkin is reloaded in place.
+	assert.Same(t, tracing, a.GetPlugin(zipkin.Name))
+	assert.Equal(t, 0.5, a.pluginSet().get(zipkin.Name).spec.(zipkin.Spec).SampleRate)
+
+	assert.Eventually(t, func() bool {
+		return len(closed.list()) == 2
+	}, time.Second, time.Millisecond)
+	assert.ElementsMatch(t, []string{"changed", "removed"}, closed.list())
+}
+
+func TestReloadInvalidConfig(t *testing.T) {
+	zipkinSpec := newTestZipkinSpec(&memReporter{})
+	a, err := New(&Config{Plugins: []plugins.Spec{newTestSpec("test", nil), zipkinSpec}})
+	assert.Nil(t, err)
+	defer a.Close()
+
+	set := a.pluginSet()
+
+	invalidSpec := zipkinSpec
+	invalidSpec.EnableBasicAuth = true
+	err = a.Reload(&Config{Plugins: []plugins.Spec{invalidSpec}})
+	assert.NotNil(t, err)
+
+	invalidSpec = zipkinSpec
+	invalidSpec.SampleRate = 2
+	err = a.Reload(&Config{Plugins: []plugins.Spec{invalidSpec}})
+	assert.NotNil(t, err)
+
+	err = a.Reload(&Config{Plugins: []plugins.Spec{newTestSpec("test", nil), newTestSpec("test", nil)}})
+	assert.NotNil(t, err)
+
+	assert.Same(t, set, a.pluginSet())
+	assert.Equal(t, 1.0, a.pluginSet().get(zipkin.Name).spec.(zipkin.Spec).SampleRate)
+}
+
+func TestWrappedHandlerFollowsReload(t *testing.T) {
+	closed := &recorder{}
+	a, err := New(&Config{Plugins: []plugins.Spec{newTestSpec("test", closed)}})
+	assert.Nil(t, err)
+	defer a.Close()
+
+	entered, blocked := make(chan struct{}), make(chan struct{})
+	handler := a.WrapUserHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			close(entered)
+			<-blocked
+		}
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "test=", w.Header().Get("X-Test"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/block", nil))
+	}()
+	<-entered
+
+	spec := newTestSpec("test", closed)
+	spec.Value = "new"
+	err = a.Reload(&Config{Plugins: []plugins.Spec{spec}})
+	assert.Nil(t, err)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "test=new", w.Header().Get("X-Test"))
+
+	// The old plugin is closed after the in-flight request finished.
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, closed.list())
+	close(blocked)
+	<-done
+	assert.Eventually(t, func() bool {
+		return len(closed.list()) == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestWatchYAML(t *testing.T) {
+	yamlFile := filepath.Join(t.TempDir(), "agent.yml")
+	writeFile := func(content string) {
+		assert.Nil(t, ioutil.WriteFile(yamlFile, []byte(content), 0o644))
+	}
+	sampleRate := func(a *Agent) float64 {
+		return a.pluginSet().get(zipkin.Name).spec.(zipkin.Spec).SampleRate
+	}
+
+	writeFile("address: 127.0.0.1:0\ntracing.sample.rate: 1\n")
+	a, err := NewWithOptions(WithYAML(yamlFile, ""), WithReload(5*time.Millisecond))
+	assert.Nil(t, err)
+	defer a.Close()
+	assert.Equal(t, 1.0, sampleRate(a))
+
+	writeFile("address: 127.0.0.1:0\ntracing.sample.rate: 0.5\n")
+	assert.Eventually(t, func() bool {
+		return sampleRate(a) == 0.5
+	}, time.Second, time.Millisecond)
+
+	// The invalid config is rejected.
+	writeFile("address: 127.0.0.1:0\ntracing.sample.rate: [0.1]\n")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0.5, sampleRate(a))
+}
@@ -0,0 +1,399 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+	"github.com/megaease/easeagent-sdk-go/plugins/zipkin"
+)
+
+const (
+	defaultRemoteInterval   = 30 * time.Second
+	defaultRemoteTimeout    = 10 * time.Second
+	defaultRemoteMaxBackoff = 5 * time.Minute
+	// minRemoteBackoff is the first backoff of long polling.
+	minRemoteBackoff = time.Second
+	// maxRemoteConfigSize is the max size of the config responded by the config server.
+	maxRemoteConfigSize = 1 << 20
+)
+
+type (
+	// RemoteConfig is the config of polling agent settings from an HTTP config server,
+	// such as MegaEase Cloud. The server responds the config values in a JSON object
+	// keyed by the flat config keys, such as {"tracing.sample.rate": 0.5}, please see
+	// doc/about-config.md. The values override the keys of the config loaded by
+	// the former options, and the changes are applied by Agent.Reload.
+	// The response is at most 1MiB, and the rejected values are fetched again.
+	RemoteConfig struct {
+		// URL is the url of the config server.
+		URL string
+		// Interval is the interval of polling, default 30s. Negative value means
+		// long polling, which requests again immediately, and the server could
+		// hold the request until the config changes or Timeout.
+		Interval time.Duration
+		// Timeout is the timeout of each request, default 10s.
+		Timeout time.Duration
+		// MaxBackoff is the max interval of retrying failures, default 5m,
+		// the interval of retrying doubles from Interval on each failure.
+		MaxBackoff time.Duration
+		// Client overrides the HTTP client, nil means using the mTLS material
+		// of the Zipkin spec if its tls is enabled.
+		Client *http.Client
+	}
+
+	// remoteClient polls the config server, and keeps the latest values,
+	// it's shared by the options applied again for reloading.
+	remoteClient struct {
+		spec RemoteConfig
+
+		mutex  sync.Mutex
+		client *http.Client
+		inited bool
+		etag   string
+		values map[string]interface{}
+
+		// pending is the fetched values not committed yet, they are used
+		// by the options until they are committed or discarded.
+		pending     map[string]interface{}
+		pendingETag string
+	}
+)
+
+// WithRemoteConfig polls agent settings from the HTTP config server,
+// it should be put after the options loading local config such as WithYAML.
+// The first request is sent synchronously, and the failure is recorded, please see WithStrictConfig.
+// @param  remote RemoteConfig the url and polling parameters, please see RemoteConfig.
+// @return ConfigOption
+func WithRemoteConfig(remote RemoteConfig) ConfigOption {
+	if remote.Interval == 0 {
+		remote.Interval = defaultRemoteInterval
+	}
+	if remote.Timeout <= 0 {
+		remote.Timeout = defaultRemoteTimeout
+	}
+	if remote.MaxBackoff <= 0 {
+		remote.MaxBackoff = defaultRemoteMaxBackoff
+	}
+	rc := &remoteClient{spec: remote}
+
+	return func(c *Config) {
+		c.remote = rc
+
+		err := rc.init(c)
+		if err != nil {
+			log.Printf("load remote config failed: %v", err)
+			c.errs = append(c.errs, err)
+		}
+
+		values := rc.latest()
+		for _, key := range unknownKeys(values) {
+			c.addWarning(fmt.Errorf("unknown key %s from remote %s", key, remote.URL))
+		}
+
+		err = c.applyValues(values)
+		if err != nil {
+			log.Printf("apply remote config failed: %v", err)
+			c.errs = append(c.errs, err)
+		}
+	}
+}
+
+// init creates the client and fetches the config once.
+func (rc *remoteClient) init(c *Config) error {
+	rc.mutex.Lock()
+	if rc.inited {
+		rc.mutex.Unlock()
+		return nil
+	}
+	rc.inited = true
+
+	rc.client = rc.spec.Client
+	if rc.client == nil {
+		client, err := newRemoteHTTPClient(c)
+		if err != nil {
+			rc.mutex.Unlock()
+			return err
+		}
+		rc.client = client
+	}
+	rc.mutex.Unlock()
+
+	_, err := rc.fetch(context.Background())
+	rc.commit()
+	return err
+}
+
+func newRemoteHTTPClient(c *Config) (*http.Client, error) {
+	transport := http.DefaultTransport
+	for _, spec := range c.Plugins {
+		zipkinSpec, ok := spec.(zipkin.Spec)
+		if !ok {
+			continue
+		}
+
+		tlsConfig, err := zipkinSpec.TLSConfig()
+		if err != nil {
+			return nil, fmt.Errorf("create remote config client failed: %v", err)
+		}
+		if tlsConfig != nil {
+			transport = &http.Transport{TLSClientConfig: tlsConfig}
+		}
+		break
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// latest returns the pending values if any, otherwise the committed ones.
+func (rc *remoteClient) latest() map[string]interface{} {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	if rc.pending != nil {
+		return rc.pending
+	}
+	return rc.values
+}
+
+// commit commits the pending values and their ETag.
+func (rc *remoteClient) commit() {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	if rc.pending != nil {
+		rc.etag, rc.values = rc.pendingETag, rc.pending
+	}
+	rc.pending, rc.pendingETag = nil, ""
+}
+
+// discard discards the pending values, so they are fetched again by the next request.
+func (rc *remoteClient) discard() {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	rc.pending, rc.pendingETag = nil, ""
+}
+
+// fetch requests the config server with the ETag of the committed values,
+// it keeps the new values pending and reports whether they changed.
+func (rc *remoteClient) fetch(ctx context.Context) (bool, error) {
+	rc.mutex.Lock()
+	etag, client := rc.etag, rc.client
+	rc.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, rc.spec.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rc.spec.URL, nil)
+	if err != nil {
+		return false, fmt.Errorf("create request of %s failed: %v", rc.spec.URL, err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("get %s failed: %v", rc.spec.URL, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("get %s failed: status code %d", rc.spec.URL, resp.StatusCode)
+	}
+
+	buff, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRemoteConfigSize+1))
+	if err != nil {
+		return false, fmt.Errorf("read body of %s failed: %v", rc.spec.URL, err)
+	}
+	if len(buff) > maxRemoteConfigSize {
+		return false, fmt.Errorf("read body of %s failed: exceed %d bytes", rc.spec.URL, maxRemoteConfigSize)
+	}
+	values, err := unmarshalValues(buff)
+	if err != nil {
+		return false, err
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	changed := !reflect.DeepEqual(rc.values, values)
+	rc.pending, rc.pendingETag = values, resp.Header.Get("ETag")
+
+	return changed, nil
+}
+
+// backoff returns the interval before the next request.
+func (rc *remoteClient) backoff(failures int) time.Duration {
+	interval := rc.spec.Interval
+	if failures == 0 {
+		if interval < 0 {
+			return 0
+		}
+		return interval
+	}
+
+	if interval < minRemoteBackoff {
+		interval = minRemoteBackoff
+	}
+	for i := 1; i < failures && interval < rc.spec.MaxBackoff; i++ {
+		interval *= 2
+	}
+	if interval > rc.spec.MaxBackoff {
+		interval = rc.spec.MaxBackoff
+	}
+
+	return interval
+}
+
+// pollRemote polls the config server until the agent is closed,
+// and reloads the config built by the options on changes.
+func (a *Agent) pollRemote(rc *remoteClient) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		// NOTE: Cancel the pending request on closing.
+		<-a.watchStop
+		cancel()
+	}()
+
+	go func() {
+		failures := 0
+		for {
+			timer := time.NewTimer(rc.backoff(failures))
+			select {
+			case <-a.watchStop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			changed, err := rc.fetch(ctx)
+			if err != nil {
+				failures++
+				log.Printf("poll remote config failed: %v, retry in %v", err, rc.backoff(failures))
+				continue
+			}
+			failures = 0
+			if !changed {
+				rc.commit()
+				continue
+			}
+
+			// NOTE: The values are committed after reloading successfully,
+			// so the other reloads don't pick up the rejected values.
+			err = a.reloadOptions()
+			if err != nil {
+				rc.discard()
+				log.Printf("reload remote config failed: %v, keep the old config", err)
+				continue
+			}
+			rc.commit()
+			log.Printf("reload remote config succeeded")
+		}
+	}()
+}
+
+// applyValues overrides the address and the keys of plugin specs by the values,
+// the name and kind of specs are kept.
+func (c *Config) applyValues(values map[string]interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	if address, exists := values["address"]; exists {
+		s, ok := address.(string)
+		if !ok {
+			return fmt.Errorf("invalid address: want string, got %v", address)
+		}
+		c.Address = s
+	}
+
+	var errs Errors
+	for i, spec := range c.Plugins {
+		newSpec, err := overrideSpec(spec, values)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("override plugin %s failed: %v", spec.Name(), err))
+			continue
+		}
+		c.Plugins[i] = newSpec
+	}
+
+	if len(errs) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// overrideSpec returns a copy of the spec whose existing keys are overridden by the values,
+// the fields out of JSON such as zipkin.Spec.Tags are kept.
+func overrideSpec(spec plugins.Spec, values map[string]interface{}) (plugins.Spec, error) {
+	buff, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %T failed: %v", spec, err)
+	}
+	keys := map[string]interface{}{}
+	if err := json.Unmarshal(buff, &keys); err != nil {
+		return nil, fmt.Errorf("unmarshal %T to map failed: %v", spec, err)
+	}
+
+	overrides := map[string]interface{}{}
+	for key, value := range values {
+		if _, exists := keys[key]; exists && key != "name" && key != "kind" {
+			overrides[key] = value
+		}
+	}
+	if len(overrides) == 0 {
+		return spec, nil
+	}
+
+	buff, err = json.Marshal(overrides)
+	if err != nil {
+		return nil, fmt.Errorf("marshal values failed: %v", err)
+	}
+
+	// NOTE: Copy the pointee of the spec of pointer type, so the spec
+	// of the current plugin is not changed.
+	if v := reflect.ValueOf(spec); v.Kind() == reflect.Ptr && !v.IsNil() {
+		ptr := reflect.New(v.Elem().Type())
+		ptr.Elem().Set(v.Elem())
+		if err := json.Unmarshal(buff, ptr.Interface()); err != nil {
+			return nil, fmt.Errorf("unmarshal %s to %T failed: %v", buff, spec, err)
+		}
+
+		return ptr.Interface().(plugins.Spec), nil
+	}
+
+	v := reflect.New(reflect.TypeOf(spec))
+	v.Elem().Set(reflect.ValueOf(spec))
+	if err := json.Unmarshal(buff, v.Interface()); err != nil {
+		return nil, fmt.Errorf("unmarshal %s to %T failed: %v", buff, spec, err)
+	}
+
+	return v.Elem().Interface().(plugins.Spec), nil
+}
@@ -0,0 +1,160 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+	"github.com/megaease/easeagent-sdk-go/plugins/zipkin"
+	"github.com/stretchr/testify/assert"
+)
+
+// configServer is an HTTP config server supporting ETag.
+type configServer struct {
+	mutex       sync.Mutex
+	etag        string
+	body        string
+	status      int
+	notModified int
+}
+
+func (s *configServer) set(etag, body string, status int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.etag, s.body, s.status = etag, body, status
+}
+
+func (s *configServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.status != http.StatusOK {
+		w.WriteHeader(s.status)
+		return
+	}
+	if r.Header.Get("If-None-Match") == s.etag {
+		s.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	w.Write([]byte(s.body))
+}
+
+func (s *configServer) notModifiedCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.notModified
+}
+
+func currentZipkinSpec(a *Agent) zipkin.Spec {
+	return a.pluginSet().get(zipkin.Name).spec.(zipkin.Spec)
+}
+
+func TestRemoteConfig(t *testing.T) {
+	cs := &configServer{}
+	cs.set(`"v1"`, `{"serviceName":"remote","tracing.sample.rate":0.5}`, http.StatusOK)
+	server := httptest.NewServer(cs)
+	defer server.Close()
+
+	a, err := NewWithOptions(WithYAML("", "127.0.0.1:8080"), WithAddress(""),
+		WithRemoteConfig(RemoteConfig{URL: server.URL, Interval: 5 * time.Millisecond}))
+	assert.Nil(t, err)
+	defer a.Close()
+
+	// The first config is loaded synchronously.
+	spec := currentZipkinSpec(a)
+	assert.Equal(t, "remote", spec.ServiceName)
+	assert.Equal(t, 0.5, spec.SampleRate)
+	assert.Equal(t, "127.0.0.1:8080", spec.LocalHostport)
+
+	assert.Eventually(t, func() bool { return cs.notModifiedCount() > 0 }, time.Second, time.Millisecond)
+
+	cs.set(`"v2"`, `{"serviceName":"remote","tracing.sample.rate":0.25}`, http.StatusOK)
+	assert.Eventually(t, func() bool { return currentZipkinSpec(a).SampleRate == 0.25 }, time.Second, time.Millisecond)
+
+	// The invalid config is rejected, and the polling recovers from failures.
+	cs.set(`"v3"`, `{"tracing.sample.rate":"high"}`, http.StatusOK)
+	time.Sleep(20 * time.Millisecond)
+	cs.set(`"v4"`, ``, http.StatusInternalServerError)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 0.25, currentZipkinSpec(a).SampleRate)
+
+	// The rejected config is not kept for the other reloads.
+	assert.Nil(t, a.reloadOptions())
+	assert.Equal(t, 0.25, currentZipkinSpec(a).SampleRate)
+
+	cs.set(`"v5"`, `{"tracing.sample.rate":0.75}`, http.StatusOK)
+	assert.Eventually(t, func() bool { return currentZipkinSpec(a).SampleRate == 0.75 }, 3*time.Second, time.Millisecond)
+	assert.Equal(t, zipkin.NewConsoleReportSpec("").ServiceName, currentZipkinSpec(a).ServiceName)
+}
+
+func TestRemoteConfigUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	remote := RemoteConfig{URL: server.URL, Interval: time.Hour}
+	a, err := NewWithOptions(WithYAML("", ""), WithAddress(""), WithRemoteConfig(remote))
+	assert.Nil(t, err)
+	assert.Nil(t, a.Close())
+
+	_, err = NewWithOptions(WithYAML("", ""), WithRemoteConfig(remote), WithStrictConfig())
+	assert.Contains(t, err.Error(), "status code 404")
+}
+
+func TestRemoteConfigTooLarge(t *testing.T) {
+	cs := &configServer{}
+	cs.set(`"v1"`, `{"serviceName":"`+strings.Repeat("a", maxRemoteConfigSize)+`"}`, http.StatusOK)
+	server := httptest.NewServer(cs)
+	defer server.Close()
+
+	remote := RemoteConfig{URL: server.URL, Interval: time.Hour}
+	_, err := NewWithOptions(WithYAML("", ""), WithRemoteConfig(remote), WithStrictConfig())
+	assert.Contains(t, err.Error(), "exceed")
+}
+
+func TestOverrideSpec(t *testing.T) {
+	spec := &testSpec{BaseSpec: plugins.BaseSpec{KindField: testKind, NameField: "test"}, Value: "old"}
+	newSpec, err := overrideSpec(spec, map[string]interface{}{"value": "new", "name": "ignored"})
+	assert.Nil(t, err)
+	assert.Equal(t, "new", newSpec.(*testSpec).Value)
+	assert.Equal(t, "test", newSpec.Name())
+
+	// The spec of pointer type is copied.
+	assert.Equal(t, "old", spec.Value)
+}
+
+func TestRemoteBackoff(t *testing.T) {
+	rc := &remoteClient{spec: RemoteConfig{Interval: 2 * time.Second, MaxBackoff: 10 * time.Second}}
+	assert.Equal(t, 2*time.Second, rc.backoff(0))
+	assert.Equal(t, 2*time.Second, rc.backoff(1))
+	assert.Equal(t, 4*time.Second, rc.backoff(2))
+	assert.Equal(t, 8*time.Second, rc.backoff(3))
+	assert.Equal(t, 10*time.Second, rc.backoff(4))
+
+	// Long polling requests again immediately, and backs off from 1s.
+	rc.spec.Interval = -1
+	assert.Equal(t, time.Duration(0), rc.backoff(0))
+	assert.Equal(t, time.Second, rc.backoff(1))
+	assert.Equal(t, 2*time.Second, rc.backoff(2))
+}
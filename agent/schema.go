@@ -0,0 +1,71 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"sort"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+	"golang.org/x/exp/maps"
+)
+
+// ConfigSchema returns the JSON Schema of agent.yml, which covers the keys of
+// Config and the built-in plugins, and the kinds of all registered plugins
+// in the plugins list. The defaults are the ones of WithYAML, please see DefaultsSource.
+func ConfigSchema() *plugins.Schema {
+	schema := plugins.SpecSchema(Config{})
+	schema.Schema = plugins.SchemaDraft
+	schema.Title = "agent.yml"
+	schema.Description = "The config of easeagent-sdk-go, please see doc/about-config.md."
+
+	for _, t := range configTypes[1:] {
+		for key, property := range plugins.SpecSchema(t).Properties {
+			if key == "kind" || key == "name" {
+				continue
+			}
+			// NOTE: The plugins might share the same keys such as serviceName.
+			if _, exists := schema.Properties[key]; !exists {
+				schema.Properties[key] = property
+			}
+		}
+	}
+
+	kinds := maps.Keys(plugins.KindSchemas())
+	sort.Strings(kinds)
+	schema.Properties["plugins"] = &plugins.Schema{
+		Description: "the specs of plugins, the spec of the same name replaces the one above",
+		Type:        "array",
+		Items: &plugins.Schema{
+			Type: "object",
+			Properties: map[string]*plugins.Schema{
+				"kind": {Type: "string", Description: "the kind of plugin", Enum: kinds},
+				"name": {Type: "string", Description: "the unique name of plugin"},
+			},
+			Required: []string{"kind", "name"},
+		},
+	}
+
+	// NOTE: DefaultsSource never fails.
+	defaults, _ := DefaultsSource().Load()
+	for key, property := range schema.Properties {
+		if value, exists := defaults[key]; exists {
+			property.Default = value
+		}
+	}
+
+	return schema
+}
@@ -0,0 +1,136 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigSchema(t *testing.T) {
+	schema := ConfigSchema()
+	assert.Equal(t, plugins.SchemaDraft, schema.Schema)
+	assert.Equal(t, false, schema.AdditionalProperties)
+
+	assert.Equal(t, "string", schema.Properties["address"].Type)
+	assert.Equal(t, "string", schema.Properties["agentType"].Type)
+
+	rate := schema.Properties["tracing.sample.rate"]
+	assert.Equal(t, "number", rate.Type)
+	assert.Equal(t, 0.0, *rate.Minimum)
+	assert.Equal(t, 1.0, *rate.Maximum)
+	assert.Equal(t, 1.0, rate.Default)
+
+	// The defaults are the ones of WithYAML.
+	assert.Equal(t, "", schema.Properties["reporter.output.server"].Default)
+}
+
+func TestDefaultSpecsMatchSchema(t *testing.T) {
+	for kind, schema := range plugins.KindSchemas() {
+		cons := plugins.GetConstructor(kind)
+		assert.Nil(t, plugins.ValidateSchema(cons.DefaultSpec()), kind)
+		assert.Equal(t, kind, schema.Title)
+	}
+}
+
+// checkSchema returns the problems of the JSON value against the schema,
+// it only covers the keywords generated by plugins.SpecSchema.
+func checkSchema(schema *plugins.Schema, value interface{}, path string) []string {
+	if schema.Type == "" {
+		return nil
+	}
+
+	var msgs []string
+	switch v := value.(type) {
+	case nil:
+		if schema.Type != "array" && schema.Type != "object" {
+			msgs = append(msgs, fmt.Sprintf("%s: null is not %s", path, schema.Type))
+		}
+	case bool:
+		if schema.Type != "boolean" {
+			msgs = append(msgs, fmt.Sprintf("%s: boolean is not %s", path, schema.Type))
+		}
+	case float64:
+		if schema.Type != "number" && (schema.Type != "integer" || v != math.Trunc(v)) {
+			msgs = append(msgs, fmt.Sprintf("%s: %v is not %s", path, v, schema.Type))
+		}
+	case string:
+		if schema.Type != "string" {
+			msgs = append(msgs, fmt.Sprintf("%s: string is not %s", path, schema.Type))
+		} else if len(schema.Enum) != 0 && !contains(schema.Enum, v) {
+			msgs = append(msgs, fmt.Sprintf("%s: %q is not in enum %v", path, v, schema.Enum))
+		}
+	case []interface{}:
+		if schema.Type != "array" {
+			msgs = append(msgs, fmt.Sprintf("%s: array is not %s", path, schema.Type))
+			break
+		}
+		for i, item := range v {
+			msgs = append(msgs, checkSchema(schema.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case map[string]interface{}:
+		if schema.Type != "object" {
+			msgs = append(msgs, fmt.Sprintf("%s: object is not %s", path, schema.Type))
+			break
+		}
+		for key, item := range v {
+			if property, exists := schema.Properties[key]; exists {
+				msgs = append(msgs, checkSchema(property, item, path+"."+key)...)
+				continue
+			}
+			switch additional := schema.AdditionalProperties.(type) {
+			case bool:
+				if !additional {
+					msgs = append(msgs, fmt.Sprintf("%s: additional property %s", path, key))
+				}
+			case *plugins.Schema:
+				msgs = append(msgs, checkSchema(additional, item, path+"."+key)...)
+			}
+		}
+	}
+
+	return msgs
+}
+
+func contains(ss []string, s string) bool {
+	for _, item := range ss {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDefaultSpecsRoundTripSchema(t *testing.T) {
+	for kind, schema := range plugins.KindSchemas() {
+		buff, err := json.Marshal(plugins.GetConstructor(kind).DefaultSpec())
+		assert.Nil(t, err)
+
+		var value interface{}
+		assert.Nil(t, json.Unmarshal(buff, &value))
+		assert.Empty(t, checkSchema(schema, value, kind), string(buff))
+	}
+
+	schema := plugins.KindSchemas()["Zipkin"]
+	assert.NotEmpty(t, checkSchema(schema, map[string]interface{}{"unknown": 1.0}, "Zipkin"))
+	assert.NotEmpty(t, checkSchema(schema, map[string]interface{}{"kind": "Consul"}, "Zipkin"))
+}
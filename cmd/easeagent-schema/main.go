@@ -0,0 +1,75 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// easeagent-schema prints the JSON Schema of agent.yml, or of the spec of a plugin kind.
+//
+// Usage:
+//
+//	easeagent-schema [-kind Zipkin] [-o agent.schema.json]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/megaease/easeagent-sdk-go/agent"
+	"github.com/megaease/easeagent-sdk-go/plugins"
+	"golang.org/x/exp/maps"
+
+	// The optional plugins are registered to print their schemas.
+	_ "github.com/megaease/easeagent-sdk-go/plugins/consul"
+	_ "github.com/megaease/easeagent-sdk-go/plugins/resilience"
+)
+
+func main() {
+	kind := flag.String("kind", "", "print the schema of the plugin kind instead of agent.yml")
+	output := flag.String("o", "", "write the schema to the file instead of stdout")
+	flag.Parse()
+
+	schema := agent.ConfigSchema()
+	if *kind != "" {
+		schemas := plugins.KindSchemas()
+		kindSchema, exists := schemas[*kind]
+		if !exists {
+			kinds := maps.Keys(schemas)
+			sort.Strings(kinds)
+			log.Fatalf("plugin kind %s not found, available kinds: %v", *kind, kinds)
+		}
+		kindSchema.Schema = plugins.SchemaDraft
+		schema = kindSchema
+	}
+
+	buff, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		log.Fatalf("marshal schema failed: %v", err)
+	}
+	buff = append(buff, '\n')
+
+	if *output == "" {
+		fmt.Print(string(buff))
+		return
+	}
+
+	if err := ioutil.WriteFile(*output, buff, 0o644); err != nil {
+		log.Printf("write schema to %s failed: %v", *output, err)
+		os.Exit(1)
+	}
+}
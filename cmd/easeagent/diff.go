@@ -0,0 +1,154 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/megaease/easeagent-sdk-go/agent"
+	"github.com/megaease/easeagent-sdk-go/plugins"
+	"golang.org/x/exp/maps"
+)
+
+func diff(fileA, fileB string, stdout, stderr io.Writer) int {
+	configA, okA := loadConfig(fileA, stderr)
+	configB, okB := loadConfig(fileB, stderr)
+	if !okA || !okB {
+		return exitInvalid
+	}
+
+	lines, err := diffConfigs(configA, configB)
+	if err != nil {
+		fmt.Fprintf(stderr, "diff %s and %s failed: %v\n", fileA, fileB, err)
+		return exitInvalid
+	}
+
+	for _, line := range lines {
+		fmt.Fprintln(stdout, line)
+	}
+	if len(lines) != 0 {
+		return exitFailed
+	}
+
+	return exitOK
+}
+
+// diffConfigs returns the semantic differences of the configs, the plugins
+// are matched by names, and the secret values are masked.
+func diffConfigs(a, b *agent.Config) ([]string, error) {
+	var lines []string
+	if a.Address != b.Address {
+		lines = append(lines, fmt.Sprintf("~ address: %q -> %q", a.Address, b.Address))
+	}
+
+	specsA, err := specsByName(a)
+	if err != nil {
+		return nil, err
+	}
+	specsB, err := specsByName(b)
+	if err != nil {
+		return nil, err
+	}
+
+	names := maps.Keys(specsA)
+	for name := range specsB {
+		if _, exists := specsA[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		specA, specB := specsA[name], specsB[name]
+		switch {
+		case specA == nil:
+			lines = append(lines, fmt.Sprintf("+ plugin %s (%s)", name, specB["kind"]))
+		case specB == nil:
+			lines = append(lines, fmt.Sprintf("- plugin %s (%s)", name, specA["kind"]))
+		default:
+			keyLines := diffSpecs(specA, specB)
+			if len(keyLines) != 0 {
+				lines = append(lines, fmt.Sprintf("~ plugin %s (%s)", name, specB["kind"]))
+				lines = append(lines, keyLines...)
+			}
+		}
+	}
+
+	return lines, nil
+}
+
+func diffSpecs(a, b map[string]interface{}) []string {
+	keys := maps.Keys(a)
+	for key := range b {
+		if _, exists := a[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var lines []string
+	for _, key := range keys {
+		valueA, existsA := a[key]
+		valueB, existsB := b[key]
+		switch {
+		case !existsA:
+			lines = append(lines, fmt.Sprintf("    + %s: %s", key, formatValue(key, valueB)))
+		case !existsB:
+			lines = append(lines, fmt.Sprintf("    - %s: %s", key, formatValue(key, valueA)))
+		case !reflect.DeepEqual(valueA, valueB):
+			lines = append(lines, fmt.Sprintf("    ~ %s: %s -> %s", key, formatValue(key, valueA), formatValue(key, valueB)))
+		}
+	}
+
+	return lines
+}
+
+func specsByName(config *agent.Config) (map[string]map[string]interface{}, error) {
+	specs := map[string]map[string]interface{}{}
+	for _, spec := range config.Plugins {
+		buff, err := json.Marshal(spec)
+		if err != nil {
+			return nil, fmt.Errorf("marshal plugin %s failed: %v", spec.Name(), err)
+		}
+
+		m := map[string]interface{}{}
+		if err := json.Unmarshal(buff, &m); err != nil {
+			return nil, fmt.Errorf("unmarshal plugin %s failed: %v", spec.Name(), err)
+		}
+		specs[spec.Name()] = m
+	}
+
+	return specs, nil
+}
+
+// formatValue formats the value in JSON, the non-empty secret values are masked.
+func formatValue(key string, value interface{}) string {
+	if plugins.IsSecretKey(key) && value != "" && value != nil {
+		return plugins.RedactedValue
+	}
+
+	buff, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(buff)
+}
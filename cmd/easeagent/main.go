@@ -0,0 +1,87 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// easeagent checks the agent config files without starting the service.
+//
+// Usage:
+//
+//	easeagent validate agent.yml
+//	easeagent render [-format yaml|json] agent.yml
+//	easeagent diff a.yml b.yml
+//
+// The config files are loaded as agent.WithYAML does, so the environment
+// variables override the keys in them.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	// The optional plugins are registered to validate and render their specs.
+	_ "github.com/megaease/easeagent-sdk-go/plugins/consul"
+	_ "github.com/megaease/easeagent-sdk-go/plugins/resilience"
+)
+
+const usage = `Usage:
+  easeagent validate agent.yml                 validate the config and all plugin specs
+  easeagent render [-format yaml|json] agent.yml  print the resolved config with secrets masked
+  easeagent diff a.yml b.yml                   print the semantic differences per plugin
+`
+
+// The exit codes follow diff(1), 1 means invalid config or differences.
+const (
+	exitOK      = 0
+	exitFailed  = 1
+	exitInvalid = 2
+)
+
+func main() {
+	// NOTE: The problems of config are reported by the commands,
+	// so the logs of loading config are duplicated.
+	log.SetOutput(ioutil.Discard)
+
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitInvalid
+	}
+
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "yaml", "the format of rendered config, yaml or json")
+	if err := flags.Parse(args[1:]); err != nil {
+		return exitInvalid
+	}
+
+	switch {
+	case args[0] == "validate" && flags.NArg() == 1:
+		return validate(flags.Arg(0), stdout, stderr)
+	case args[0] == "render" && flags.NArg() == 1:
+		return render(flags.Arg(0), *format, stdout, stderr)
+	case args[0] == "diff" && flags.NArg() == 2:
+		return diff(flags.Arg(0), flags.Arg(1), stdout, stderr)
+	default:
+		fmt.Fprint(stderr, usage)
+		return exitInvalid
+	}
+}
@@ -0,0 +1,90 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, ioutil.WriteFile(file, []byte(content), 0o644))
+	return file
+}
+
+func runCommand(args ...string) (int, string, string) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run(args, stdout, stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestValidate(t *testing.T) {
+	file := writeFile(t, "agent.yml", "serviceName: demo\ntracing.sample.rate: 0.5\n")
+	code, stdout, _ := runCommand("validate", file)
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, file+" is valid, 3 plugins\n", stdout)
+
+	file = writeFile(t, "bad.yml", "tracing.sample.rat: 0.5\ntracing.sample.rate: 2\n")
+	code, _, stderr := runCommand("validate", file)
+	assert.Equal(t, exitFailed, code)
+	assert.Contains(t, stderr, "  - unknown key tracing.sample.rat from yaml:"+file+"\n")
+	assert.Contains(t, stderr, "  - validate plugin Zipkin failed: tracing.sample.rate 2 is out of range [0, 1]\n")
+
+	code, _, stderr = runCommand("validate")
+	assert.Equal(t, exitInvalid, code)
+	assert.Contains(t, stderr, "Usage:")
+}
+
+func TestRender(t *testing.T) {
+	file := writeFile(t, "agent.yml", "serviceName: demo\nreporter.output.server.auth.password: secret\n")
+
+	code, stdout, _ := runCommand("render", file)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "  serviceName: demo\n")
+	assert.Contains(t, stdout, "  reporter.output.server.auth.password: '******'\n")
+	assert.Contains(t, stdout, "  tracing.sample.rate: 1\n")
+	assert.NotContains(t, stdout, "secret")
+
+	code, stdout, _ = runCommand("render", "-format", "json", file)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"serviceName": "demo"`)
+
+	code, _, _ = runCommand("render", "-format", "xml", file)
+	assert.Equal(t, exitInvalid, code)
+}
+
+func TestDiff(t *testing.T) {
+	fileA := writeFile(t, "a.yml", "address: :9900\nserviceName: a\nreporter.output.server.auth.password: p1\n")
+	fileB := writeFile(t, "b.yml", "address: :9901\nserviceName: b\nreporter.output.server.auth.password: p2\n")
+
+	code, stdout, _ := runCommand("diff", fileA, fileB)
+	assert.Equal(t, exitFailed, code)
+	assert.Equal(t, `~ address: ":9900" -> ":9901"
+~ plugin Zipkin (Zipkin)
+    ~ reporter.output.server.auth.password: ****** -> ******
+    ~ serviceName: "a" -> "b"
+`, stdout)
+
+	code, stdout, _ = runCommand("diff", fileA, fileA)
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "", stdout)
+}
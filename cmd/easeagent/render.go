@@ -0,0 +1,100 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ghodss/yaml"
+	"github.com/megaease/easeagent-sdk-go/agent"
+	"github.com/megaease/easeagent-sdk-go/plugins"
+)
+
+// renderedConfig is the resolved config in the form of agent.yml.
+type renderedConfig struct {
+	Address string                   `json:"address"`
+	Plugins []map[string]interface{} `json:"plugins"`
+}
+
+// loadConfig loads the config file and reports all problems of it.
+func loadConfig(file string, stderr io.Writer) (*agent.Config, bool) {
+	config, err := agent.LoadConfig(agent.WithYAML(file, ""))
+	if err == nil {
+		return config, true
+	}
+
+	fmt.Fprintf(stderr, "%s is invalid:\n", file)
+	if errs, ok := err.(agent.Errors); ok {
+		for _, err := range errs {
+			fmt.Fprintf(stderr, "  - %v\n", err)
+		}
+	} else {
+		fmt.Fprintf(stderr, "  - %v\n", err)
+	}
+
+	return nil, false
+}
+
+func validate(file string, stdout, stderr io.Writer) int {
+	config, ok := loadConfig(file, stderr)
+	if !ok {
+		return exitFailed
+	}
+
+	fmt.Fprintf(stdout, "%s is valid, %d plugins\n", file, len(config.Plugins))
+	return exitOK
+}
+
+func render(file, format string, stdout, stderr io.Writer) int {
+	if format != "yaml" && format != "json" {
+		fmt.Fprintf(stderr, "unknown format %s, want yaml or json\n", format)
+		return exitInvalid
+	}
+
+	config, ok := loadConfig(file, stderr)
+	if !ok {
+		return exitFailed
+	}
+
+	rendered := &renderedConfig{Address: config.Address}
+	for _, spec := range config.Plugins {
+		m, err := plugins.RedactSpec(spec)
+		if err != nil {
+			fmt.Fprintf(stderr, "render plugin %s failed: %v\n", spec.Name(), err)
+			return exitFailed
+		}
+		rendered.Plugins = append(rendered.Plugins, m)
+	}
+
+	var buff []byte
+	var err error
+	if format == "json" {
+		buff, err = json.MarshalIndent(rendered, "", "  ")
+		buff = append(buff, '\n')
+	} else {
+		buff, err = yaml.Marshal(rendered)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "marshal config failed: %v\n", err)
+		return exitFailed
+	}
+
+	stdout.Write(buff)
+	return exitOK
+}
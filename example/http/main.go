@@ -38,16 +38,7 @@ const (
 // new tracing agent from yaml file and set host and port of Span.localEndpoint
 // By default, use yamlFile="" is use easemesh.DefaultSpec() and Console Reporter for tracing.
 // By default, use localHostPort="" is not set host and port of Span.localEndpoint.
-var easeagent, _ = agent.NewWithOptions(agent.WithYAML(os.Getenv("EASEAGENT_CONFIG"), localHostPort))
-var tracing = easeagent.GetPlugin(zipkin.Name).(zipkin.Tracing)
-
-// var tracing = func() zipkin.Tracing {
-// 	if easeagent_err != nil {
-// 		log.Printf("new easeagent error : %v", easeagent_err)
-// 		os.Exit(1)
-// 	}
-// 	return easeagent.GetPlugin(zipkin.Name).(zipkin.Tracing)
-// }()
+var easeagent, easeagentErr = agent.NewWithOptions(agent.WithYAML(os.Getenv("EASEAGENT_CONFIG"), localHostPort))
 
 func otherFunc() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -61,7 +52,7 @@ func otherFunc() http.HandlerFunc {
 // 	- http client WrapHttpRequest(span_1(tracing info))  -> span_2
 // 		- http server /other_function 2 -> span_3
 
-func someFunc(url string, client plugins.HTTPDoer) http.HandlerFunc {
+func someFunc(url string, client plugins.HTTPDoer, tracing zipkin.Tracing) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// created span by server middleware
 		log.Printf("some_function called with method: %s\n", r.Method)
@@ -99,9 +90,17 @@ func someFunc(url string, client plugins.HTTPDoer) http.HandlerFunc {
 }
 
 func main() {
+	if easeagentErr != nil {
+		log.Fatalf("new easeagent failed: %v", easeagentErr)
+	}
+	tracing, ok := agent.PluginAs[zipkin.Tracing](easeagent, zipkin.Name)
+	if !ok {
+		log.Fatalf("tracing plugin %s not found", zipkin.Name)
+	}
+
 	// initialize router
 	router := http.NewServeMux()
-	router.HandleFunc("/some_function", someFunc("http://"+localHostPort, easeagent.WrapUserClient(&http.Client{})))
+	router.HandleFunc("/some_function", someFunc("http://"+localHostPort, easeagent.WrapUserClient(&http.Client{}), tracing))
 	router.HandleFunc("/other_function", otherFunc())
 	http.ListenAndServe(localHostPort, easeagent.WrapUserHandler(router))
 }
@@ -41,7 +41,6 @@ import (
 
 var (
 	podServicePort = 80
-	podEgressPort  = 13002
 
 	zipKinURL = os.Getenv("ZIPKIN_URL")
 
@@ -259,7 +258,8 @@ func prefligt() {
 					KindField: easemesh.Kind,
 					NameField: "easemesh",
 				},
-				AgentType: agentType,
+				AgentType:      agentType,
+				EgressServices: []string{"*-mesh", "*-mesh-*"},
 			},
 			zipkinSpec,
 		},
@@ -271,7 +271,8 @@ func prefligt() {
 		exitf("create sdk agent failed: %v", err)
 	}
 
-	globalHTTPClient = globalAgent.WrapUserClient(http.DefaultClient)
+	// NOTE: The client sends the requests of logical service URLs through the sidecar egress.
+	globalHTTPClient = globalAgent.WrapUserClient(easemesh.NewEgressClient())
 }
 
 func chainReqs(serverReq, clientReq *http.Request) *http.Request {
@@ -295,11 +296,19 @@ func main() {
 		}
 	}()
 
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT)
 	<-ch
 
-	serviceServer.Shutdown(context.TODO())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	serviceServer.Shutdown(ctx)
+
+	err := globalAgent.Shutdown(ctx)
+	if err != nil {
+		log.Printf("shutdown agent failed: %v", err)
+	}
 }
 
 func exitf(format string, args ...interface{}) {
@@ -389,12 +398,11 @@ func (h *serviceHandler) handleOrder(serverReq *http.Request, body []byte) (inte
 		return nil, fmt.Errorf("marshal failed: %v", err)
 	}
 
-	restaurantURL := fmt.Sprintf("http://%s:%d", completeAnotherServiceName(restaurantService), podEgressPort)
+	restaurantURL := fmt.Sprintf("http://%s", completeAnotherServiceName(restaurantService))
 	restaurantClientReq, err := http.NewRequest("POST", restaurantURL, bytes.NewReader(restaurantReqBody))
 	if err != nil {
 		return nil, fmt.Errorf("create request failed: %v", err)
 	}
-	restaurantClientReq.Header = serverReq.Header.Clone()
 	restaurantClientReq.Header.Set("Content-Type", "application/json")
 	restaurantClientReq = chainReqs(serverReq, restaurantClientReq)
 
@@ -447,12 +455,11 @@ func (h *serviceHandler) handleRestaurant(serverReq *http.Request, body []byte)
 		return nil, fmt.Errorf("marshal failed: %v", err)
 	}
 
-	deliveryURL := fmt.Sprintf("http://%s:%d", completeAnotherServiceName(deliveryService), podEgressPort)
+	deliveryURL := fmt.Sprintf("http://%s", completeAnotherServiceName(deliveryService))
 	deliveryClientReq, err := http.NewRequest("POST", deliveryURL, bytes.NewReader(deliveryReqBody))
 	if err != nil {
 		return nil, fmt.Errorf("create request failed: %v", err)
 	}
-	deliveryClientReq.Header = serverReq.Header.Clone()
 	deliveryClientReq.Header.Set("Content-Type", "application/json")
 	deliveryClientReq = chainReqs(serverReq, deliveryClientReq)
 
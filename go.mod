@@ -8,6 +8,7 @@ require (
 	github.com/megaease/consuldemo v0.0.0-20221103090839-e2017aec6239
 	github.com/opentracing/opentracing-go v1.2.0
 	github.com/openzipkin/zipkin-go v0.4.1
+	github.com/stretchr/testify v1.8.1
 	golang.org/x/exp v0.0.0-20221031165847-c99f073a8326
 	gopkg.in/yaml.v2 v2.4.0
 )
@@ -18,7 +19,6 @@ require (
 	github.com/openzipkin-contrib/zipkin-go-opentracing v0.4.5 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/objx v0.5.0 // indirect
-	github.com/stretchr/testify v1.8.1 // indirect
 	golang.org/x/net v0.0.0-20221004154528-8021a29435af // indirect
 	google.golang.org/grpc v1.50.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
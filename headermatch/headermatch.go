@@ -0,0 +1,208 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package headermatch matches the HTTP headers forwarded along the chain,
+// such as the canary headers of EaseMesh.
+package headermatch
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxMatched is the max count of matched keys recorded for debugging.
+const maxMatched = 256
+
+type (
+	// Matcher matches header keys against the patterns separated by commas, the pattern is one of:
+	//   - the header name, such as X-Canary
+	//   - the header prefix ending with *, such as X-Mesh-*
+	//   - the regular expression enclosed by slashes, such as /^X-(Canary|Location)$/
+	// All patterns are case-insensitive, and the regular expression must not contain commas.
+	// A nil Matcher matches nothing.
+	Matcher struct {
+		patterns []string
+		names    map[string]struct{}
+		prefixes []string
+		regexps  []*regexp.Regexp
+
+		mutex   sync.RWMutex
+		matched map[string]struct{}
+	}
+)
+
+// Parse parses the patterns separated by commas, the empty patterns are ignored.
+func Parse(value string) (*Matcher, error) {
+	m := &Matcher{
+		patterns: []string{},
+		names:    map[string]struct{}{},
+		matched:  map[string]struct{}{},
+	}
+
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		switch {
+		case pattern == "":
+			continue
+		case len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/"):
+			re, err := regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid header pattern %s: %v", pattern, err)
+			}
+			m.regexps = append(m.regexps, re)
+		case strings.HasSuffix(pattern, "*"):
+			prefix := strings.TrimSuffix(pattern, "*")
+			if strings.ContainsAny(prefix, "*/ ") {
+				return nil, fmt.Errorf("invalid header pattern %s", pattern)
+			}
+			m.prefixes = append(m.prefixes, strings.ToLower(prefix))
+		default:
+			if strings.ContainsAny(pattern, "*/ ") {
+				return nil, fmt.Errorf("invalid header pattern %s", pattern)
+			}
+			pattern = http.CanonicalHeaderKey(pattern)
+			m.names[pattern] = struct{}{}
+		}
+
+		m.patterns = append(m.patterns, pattern)
+	}
+
+	return m, nil
+}
+
+// MustParse is like Parse but panics if the patterns are invalid.
+func MustParse(value string) *Matcher {
+	m, err := Parse(value)
+	if err != nil {
+		panic(err)
+	}
+
+	return m
+}
+
+// Patterns returns the parsed patterns, the header names are canonicalized.
+func (m *Matcher) Patterns() []string {
+	if m == nil {
+		return []string{}
+	}
+
+	return append([]string{}, m.patterns...)
+}
+
+// Names returns the exact header names among the patterns in order, which are canonicalized,
+// the prefixes and the regular expressions are not included.
+func (m *Matcher) Names() []string {
+	names := []string{}
+	if m == nil {
+		return names
+	}
+
+	for _, pattern := range m.patterns {
+		if _, exists := m.names[pattern]; exists {
+			names = append(names, pattern)
+		}
+	}
+
+	return names
+}
+
+// String returns the patterns separated by commas.
+func (m *Matcher) String() string {
+	return strings.Join(m.Patterns(), ",")
+}
+
+// Match returns whether the header key matches any pattern.
+func (m *Matcher) Match(key string) bool {
+	if m == nil {
+		return false
+	}
+
+	if _, exists := m.names[http.CanonicalHeaderKey(key)]; exists {
+		return true
+	}
+
+	lower := strings.ToLower(key)
+	for _, prefix := range m.prefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+
+	for _, re := range m.regexps {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filter returns the copy of headers whose keys match, the matched keys are recorded.
+func (m *Matcher) Filter(h http.Header) http.Header {
+	filtered := http.Header{}
+	if m == nil || len(m.patterns) == 0 {
+		return filtered
+	}
+
+	for key, values := range h {
+		if m.Match(key) {
+			filtered[key] = append([]string(nil), values...)
+			m.record(key)
+		}
+	}
+
+	return filtered
+}
+
+// Matched returns the sorted keys which have matched in Filter, up to 256 keys.
+func (m *Matcher) Matched() []string {
+	keys := []string{}
+	if m == nil {
+		return keys
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for key := range m.matched {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (m *Matcher) record(key string) {
+	m.mutex.RLock()
+	_, exists := m.matched[key]
+	full := len(m.matched) >= maxMatched
+	m.mutex.RUnlock()
+
+	if exists || full {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.matched) < maxMatched {
+		m.matched[key] = struct{}{}
+	}
+}
@@ -0,0 +1,77 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package headermatch
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	m, err := Parse(" x-canary, X-Mesh-*,,/^x-(loc|zone)$/ ")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"X-Canary", "X-Mesh-*", "/^x-(loc|zone)$/"}, m.Patterns())
+	assert.Equal(t, "X-Canary,X-Mesh-*,/^x-(loc|zone)$/", m.String())
+	assert.Equal(t, []string{"X-Canary"}, m.Names())
+
+	for _, key := range []string{"X-Canary", "x-canary", "X-Mesh-Zone", "x-mesh-", "X-Loc", "X-Zone"} {
+		assert.True(t, m.Match(key), key)
+	}
+	for _, key := range []string{"X-Canary-Id", "X-Mesh", "X-Location", "Content-Type"} {
+		assert.False(t, m.Match(key), key)
+	}
+
+	for _, value := range []string{"/x-(/", "X-*-Id", "X Canary", "a/b"} {
+		_, err := Parse(value)
+		assert.NotNil(t, err, value)
+	}
+
+	empty, err := Parse("")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, empty.Patterns())
+	assert.Equal(t, []string{}, empty.Names())
+	assert.False(t, empty.Match("X-Canary"))
+
+	var none *Matcher
+	assert.False(t, none.Match("X-Canary"))
+	assert.Equal(t, http.Header{}, none.Filter(http.Header{"X-Canary": {"a"}}))
+	assert.Equal(t, []string{}, none.Matched())
+}
+
+func TestFilter(t *testing.T) {
+	m := MustParse("X-Canary,X-Mesh-*")
+
+	h := http.Header{
+		"X-Canary":    {"android"},
+		"X-Mesh-Zone": {"beijing"},
+		"X-Other":     {"other"},
+	}
+	filtered := m.Filter(h)
+	assert.Equal(t, http.Header{
+		"X-Canary":    {"android"},
+		"X-Mesh-Zone": {"beijing"},
+	}, filtered)
+
+	filtered["X-Canary"][0] = "ios"
+	assert.Equal(t, "android", h.Get("X-Canary"))
+
+	assert.Equal(t, []string{"X-Canary", "X-Mesh-Zone"}, m.Matched())
+
+	assert.Panics(t, func() { MustParse("/(/") })
+}
@@ -0,0 +1,313 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package consul registers the service to Consul for the discovery of EaseMesh.
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+)
+
+const (
+	requestTimeout = 5 * time.Second
+
+	// retryInterval is the interval of retrying registration without ttl check.
+	retryInterval = 10 * time.Second
+)
+
+func init() {
+	cons := &plugins.Constructor{
+		Kind:         Kind,
+		DefaultSpec:  DefaultSpec,
+		SystemPlugin: false,
+		NewInstance:  New,
+	}
+
+	plugins.Register(cons)
+}
+
+type (
+	// Consul is the plugin registering the service to Consul.
+	// It registers the service with the health check of agent server at startup,
+	// refreshes the ttl check periodically and deregisters the service on close.
+	Consul struct {
+		client *http.Client
+		name   atomic.Value // type: string
+
+		// mutex guards the fields below, the requests to Consul are sent without it.
+		mutex sync.Mutex
+		spec  Spec
+		// generation increases on every Reload, so the stale Reload doesn't start its loop.
+		generation uint64
+		closed     bool
+		stop       chan struct{}
+		done       chan struct{}
+	}
+
+	// AgentServiceRegistration is the service registered to Consul agent.
+	AgentServiceRegistration struct {
+		ID      string              `json:"ID"`
+		Name    string              `json:"Name"`
+		Tags    []string            `json:"Tags,omitempty"`
+		Address string              `json:"Address,omitempty"`
+		Port    int                 `json:"Port,omitempty"`
+		Checks  []AgentServiceCheck `json:"Checks,omitempty"`
+	}
+
+	// AgentServiceCheck is the check of the service registered to Consul agent.
+	AgentServiceCheck struct {
+		CheckID                        string `json:"CheckID"`
+		Name                           string `json:"Name"`
+		HTTP                           string `json:"HTTP,omitempty"`
+		Interval                       string `json:"Interval,omitempty"`
+		Timeout                        string `json:"Timeout,omitempty"`
+		TTL                            string `json:"TTL,omitempty"`
+		DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter,omitempty"`
+	}
+)
+
+// New creates a Consul service registry plugin, the registration runs in background.
+func New(pluginSpec plugins.Spec) (plugins.Plugin, error) {
+	spec := pluginSpec.(Spec)
+	c := &Consul{
+		client: &http.Client{Timeout: requestTimeout},
+		spec:   spec,
+	}
+	c.name.Store(spec.Name())
+	c.start(spec)
+
+	return c, nil
+}
+
+// Name gets the Consul service registry name.
+func (c *Consul) Name() string {
+	return c.name.Load().(string)
+}
+
+// Reload applies the new spec, the service is deregistered first if its id changed.
+func (c *Consul) Reload(pluginSpec plugins.Spec) error {
+	spec := pluginSpec.(Spec)
+
+	c.mutex.Lock()
+	old, stop, done := c.spec, c.stop, c.done
+	c.spec, c.stop, c.done = spec, nil, nil
+	c.generation++
+	generation := c.generation
+	c.name.Store(spec.Name())
+	c.mutex.Unlock()
+
+	stopLoop(stop, done)
+	if oldID := old.serviceID(); oldID != spec.serviceID() {
+		err := c.deregister(old)
+		if err != nil {
+			log.Printf("deregister service %s failed: %v", oldID, err)
+		}
+	}
+
+	c.mutex.Lock()
+	if !c.closed && c.generation == generation {
+		c.start(spec)
+	}
+	c.mutex.Unlock()
+
+	return nil
+}
+
+// Close stops refreshing the ttl check and deregisters the service.
+func (c *Consul) Close() error {
+	c.mutex.Lock()
+	spec, stop, done := c.spec, c.stop, c.done
+	c.closed, c.stop, c.done = true, nil, nil
+	c.mutex.Unlock()
+
+	stopLoop(stop, done)
+	err := c.deregister(spec)
+	if err != nil {
+		return fmt.Errorf("deregister service %s failed: %v", spec.serviceID(), err)
+	}
+
+	return nil
+}
+
+// start runs the registration loop of the spec. The caller must hold the mutex
+// unless in New.
+func (c *Consul) start(spec Spec) {
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+
+	go c.run(spec, c.stop, c.done)
+}
+
+// stopLoop stops the registration loop and waits for it, nil stop means no loop.
+func stopLoop(stop, done chan struct{}) {
+	if stop == nil {
+		return
+	}
+
+	close(stop)
+	<-done
+}
+
+// run registers the service until it succeeds, then passes the ttl check every third of ttl.
+// The service is registered again if Consul lost it, such as Consul agent restarted.
+func (c *Consul) run(spec Spec, stop, done chan struct{}) {
+	defer close(done)
+
+	interval := retryInterval
+	if ttl := spec.ttl(); ttl > 0 {
+		interval = ttl / 3
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	registered := false
+	for {
+		if !registered {
+			err := c.register(spec)
+			if err != nil {
+				log.Printf("register service %s to consul failed: %v", spec.serviceID(), err)
+			} else {
+				registered = true
+			}
+		} else if spec.ttl() > 0 {
+			found, err := c.passTTL(spec)
+			if err != nil {
+				log.Printf("pass ttl check of service %s failed: %v", spec.serviceID(), err)
+			} else if !found {
+				registered = false
+				continue
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checks returns the checks of the service.
+func (spec Spec) checks() []AgentServiceCheck {
+	id := spec.serviceID()
+
+	checks := []AgentServiceCheck{
+		{
+			CheckID:                        "service:" + id + ":agent",
+			Name:                           "agent health of " + spec.ServiceName,
+			HTTP:                           fmt.Sprintf("http://%s:%d/health", spec.serviceAddress(), spec.AgentPort),
+			Interval:                       spec.CheckInterval,
+			Timeout:                        requestTimeout.String(),
+			DeregisterCriticalServiceAfter: spec.DeregisterAfter,
+		},
+	}
+
+	if spec.CheckTTL != "" {
+		checks = append(checks, AgentServiceCheck{
+			CheckID:                        ttlCheckID(spec),
+			Name:                           "ttl of " + spec.ServiceName,
+			TTL:                            spec.CheckTTL,
+			DeregisterCriticalServiceAfter: spec.DeregisterAfter,
+		})
+	}
+
+	return checks
+}
+
+func ttlCheckID(spec Spec) string {
+	return "service:" + spec.serviceID() + ":ttl"
+}
+
+func (c *Consul) register(spec Spec) error {
+	registration := &AgentServiceRegistration{
+		ID:      spec.serviceID(),
+		Name:    spec.ServiceName,
+		Tags:    spec.ServiceTags,
+		Address: spec.serviceAddress(),
+		Port:    spec.ServicePort,
+		Checks:  spec.checks(),
+	}
+
+	buff, err := json.Marshal(registration)
+	if err != nil {
+		return fmt.Errorf("marshal %T failed: %v", registration, err)
+	}
+
+	_, err = c.do(spec, "/v1/agent/service/register", bytes.NewReader(buff))
+	if err != nil {
+		return err
+	}
+
+	// Pass the ttl check at once, otherwise it stays critical until the next tick.
+	if spec.CheckTTL != "" {
+		_, err = c.passTTL(spec)
+	}
+
+	return err
+}
+
+func (c *Consul) deregister(spec Spec) error {
+	_, err := c.do(spec, "/v1/agent/service/deregister/"+url.PathEscape(spec.serviceID()), nil)
+	return err
+}
+
+// passTTL passes the ttl check, found is false if Consul doesn't know the check.
+func (c *Consul) passTTL(spec Spec) (found bool, err error) {
+	status, err := c.do(spec, "/v1/agent/check/pass/"+url.PathEscape(ttlCheckID(spec)), nil)
+	if status == http.StatusNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// do sends PUT request to Consul agent, it returns the status code and
+// the error if the status code is not 200.
+func (c *Consul) do(spec Spec, path string, body io.Reader) (int, error) {
+	req, err := http.NewRequest(http.MethodPut, strings.TrimSuffix(spec.Address, "/")+path, body)
+	if err != nil {
+		return 0, fmt.Errorf("create request failed: %v", err)
+	}
+	if spec.Token != "" {
+		req.Header.Set("X-Consul-Token", spec.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("put %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, fmt.Errorf("put %s failed: status %d: %s", path, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,237 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consul
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+)
+
+// fakeConsul is a local fake of Consul agent HTTP API.
+type fakeConsul struct {
+	*httptest.Server
+
+	mutex        sync.Mutex
+	services     map[string]*AgentServiceRegistration
+	passes       map[string]int
+	deregistered []string
+	tokens       []string
+}
+
+func newFakeConsul() *fakeConsul {
+	f := &fakeConsul{
+		services: map[string]*AgentServiceRegistration{},
+		passes:   map[string]int{},
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+
+	return f
+}
+
+func (f *fakeConsul) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	f.tokens = append(f.tokens, r.Header.Get("X-Consul-Token"))
+
+	switch {
+	case r.URL.Path == "/v1/agent/service/register":
+		registration := &AgentServiceRegistration{}
+		err := json.NewDecoder(r.Body).Decode(registration)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.services[registration.ID] = registration
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/")
+		delete(f.services, id)
+		f.deregistered = append(f.deregistered, id)
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/check/pass/"):
+		checkID := strings.TrimPrefix(r.URL.Path, "/v1/agent/check/pass/")
+		for _, service := range f.services {
+			for _, check := range service.Checks {
+				if check.CheckID == checkID {
+					f.passes[checkID]++
+					return
+				}
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeConsul) service(id string) *AgentServiceRegistration {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.services[id]
+}
+
+func (f *fakeConsul) passCount(checkID string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.passes[checkID]
+}
+
+// restart drops all services like a restarted Consul agent.
+func (f *fakeConsul) restart() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.services = map[string]*AgentServiceRegistration{}
+}
+
+func newTestSpec(address string) Spec {
+	spec := DefaultSpec().(Spec)
+	spec.Address = address
+	spec.Token = "token"
+	spec.ServiceName = "order"
+	spec.ServiceAddress = "10.0.0.1"
+	spec.ServicePort = 8080
+	spec.ServiceTags = []string{"canary"}
+	spec.CheckTTL = "150ms"
+	return spec
+}
+
+func TestRegister(t *testing.T) {
+	consul := newFakeConsul()
+	defer consul.Close()
+
+	spec := newTestSpec(consul.URL)
+	assert.Nil(t, spec.Validate())
+
+	plug, err := plugins.New(spec)
+	assert.Nil(t, err)
+
+	id := "order-10.0.0.1-8080"
+	assert.Eventually(t, func() bool { return consul.service(id) != nil }, time.Second, 10*time.Millisecond)
+
+	service := consul.service(id)
+	assert.Equal(t, "order", service.Name)
+	assert.Equal(t, []string{"canary"}, service.Tags)
+	assert.Equal(t, "10.0.0.1", service.Address)
+	assert.Equal(t, 8080, service.Port)
+	assert.Equal(t, []AgentServiceCheck{
+		{
+			CheckID:                        "service:" + id + ":agent",
+			Name:                           "agent health of order",
+			HTTP:                           "http://10.0.0.1:9900/health",
+			Interval:                       "10s",
+			Timeout:                        "5s",
+			DeregisterCriticalServiceAfter: "1m",
+		},
+		{
+			CheckID:                        "service:" + id + ":ttl",
+			Name:                           "ttl of order",
+			TTL:                            "150ms",
+			DeregisterCriticalServiceAfter: "1m",
+		},
+	}, service.Checks)
+
+	// The ttl check is refreshed periodically.
+	ttlCheckID := "service:" + id + ":ttl"
+	assert.Eventually(t, func() bool { return consul.passCount(ttlCheckID) >= 3 }, time.Second, 10*time.Millisecond)
+
+	// The service is registered again after Consul lost it.
+	consul.restart()
+	assert.Eventually(t, func() bool { return consul.service(id) != nil }, time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, plug.Close())
+	assert.Nil(t, consul.service(id))
+	assert.Equal(t, []string{id}, consul.deregistered)
+	assert.NotContains(t, consul.tokens, "")
+}
+
+func TestReload(t *testing.T) {
+	consul := newFakeConsul()
+	defer consul.Close()
+
+	spec := newTestSpec(consul.URL)
+	plug, err := plugins.New(spec)
+	assert.Nil(t, err)
+	defer plug.Close()
+
+	assert.Eventually(t, func() bool { return consul.service("order-10.0.0.1-8080") != nil }, time.Second, 10*time.Millisecond)
+
+	spec.ServiceID = "order-1"
+	assert.Nil(t, plug.(plugins.Reloader).Reload(spec))
+
+	assert.Eventually(t, func() bool { return consul.service("order-1") != nil }, time.Second, 10*time.Millisecond)
+	assert.Nil(t, consul.service("order-10.0.0.1-8080"))
+}
+
+func TestCloseUnreachable(t *testing.T) {
+	consul := newFakeConsul()
+	consul.Close()
+
+	plug, err := plugins.New(newTestSpec(consul.URL))
+	assert.Nil(t, err)
+	assert.NotNil(t, plug.Close())
+}
+
+func TestValidate(t *testing.T) {
+	spec := DefaultSpec().(Spec)
+	spec.Address = "127.0.0.1:8500"
+	spec.CheckTTL = "-1s"
+	spec.CheckInterval = "often"
+
+	err := spec.Validate()
+	assert.NotNil(t, err)
+	for _, msg := range []string{"service.name", "consul.address", "check.ttl", "check.interval"} {
+		assert.Contains(t, err.Error(), msg)
+	}
+}
+
+func TestNameWhileClosing(t *testing.T) {
+	deregistering, release := make(chan struct{}), make(chan struct{})
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/") {
+			close(deregistering)
+			<-release
+		}
+	}))
+	defer consul.Close()
+
+	plug, err := plugins.New(newTestSpec(consul.URL))
+	assert.Nil(t, err)
+
+	closed := make(chan error)
+	go func() { closed <- plug.Close() }()
+
+	// The name is served while the deregistration is blocked.
+	<-deregistering
+	assert.Equal(t, Name, plug.Name())
+	close(release)
+	assert.Nil(t, <-closed)
+}
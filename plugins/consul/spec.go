@@ -0,0 +1,145 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consul
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+)
+
+const (
+	// Kind is the kind of Consul service registry plugin.
+	Kind = "ConsulServiceRegistry"
+	// Name is the name of Consul service registry plugin.
+	Name = "ConsulServiceRegistry"
+)
+
+type (
+	// Spec is the Consul service registry spec.
+	Spec struct {
+		plugins.BaseSpec `json:",inline"`
+
+		Address string `json:"consul.address" jsonschema:"required" jsonschema_description:"the url of the Consul agent HTTP API"`
+		Token   string `json:"consul.token" jsonschema_description:"the ACL token of Consul"`
+
+		ServiceID      string   `json:"service.id" jsonschema_description:"the service id, empty value means {service.name}-{service.address}-{service.port}"`
+		ServiceName    string   `json:"service.name" jsonschema:"required" jsonschema_description:"the service name"`
+		ServiceAddress string   `json:"service.address" jsonschema_description:"the service address, empty value means the hostname"`
+		ServicePort    int      `json:"service.port" jsonschema:"minimum=0,maximum=65535" jsonschema_description:"the service port"`
+		ServiceTags    []string `json:"service.tags" jsonschema_description:"the service tags"`
+
+		AgentPort       int    `json:"agent.port" jsonschema:"minimum=1,maximum=65535" jsonschema_description:"the port of agent server checked by Consul on /health"`
+		CheckInterval   string `json:"check.interval" jsonschema_description:"the interval of the agent health check, such as 10s"`
+		CheckTTL        string `json:"check.ttl" jsonschema_description:"the ttl of the check refreshed by the plugin, such as 30s"`
+		DeregisterAfter string `json:"check.deregisterAfter" jsonschema_description:"the timeout of the critical checks to deregister the service, such as 1m"`
+	}
+)
+
+// DefaultSpec returns the default spec of Consul service registry.
+func DefaultSpec() plugins.Spec {
+	return Spec{
+		BaseSpec: plugins.BaseSpec{
+			KindField: Kind,
+			NameField: Name,
+		},
+		Address: "http://127.0.0.1:8500",
+
+		AgentPort:       9900,
+		CheckInterval:   "10s",
+		CheckTTL:        "30s",
+		DeregisterAfter: "1m",
+	}
+}
+
+// Validate validates the Consul service registry spec, it reports all problems together.
+func (spec Spec) Validate() error {
+	var msgs []string
+
+	if err := plugins.ValidateSchema(spec); err != nil {
+		msgs = append(msgs, err.Error())
+	}
+
+	if spec.ServiceName == "" {
+		msgs = append(msgs, "service.name is not specified")
+	}
+
+	if spec.Address != "" {
+		u, err := url.Parse(spec.Address)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("invalid consul.address %q: %v", spec.Address, err))
+		} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			msgs = append(msgs, fmt.Sprintf("invalid consul.address %q: want http(s)://host[:port]", spec.Address))
+		}
+	}
+
+	durations := []struct {
+		key   string
+		value string
+	}{
+		{"check.interval", spec.CheckInterval},
+		{"check.ttl", spec.CheckTTL},
+		{"check.deregisterAfter", spec.DeregisterAfter},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(d.value); err != nil || duration <= 0 {
+			msgs = append(msgs, fmt.Sprintf("invalid %s %q: want positive duration such as 10s", d.key, d.value))
+		}
+	}
+
+	if len(msgs) != 0 {
+		return fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+
+	return nil
+}
+
+// serviceAddress returns the service address, which falls back to the hostname.
+func (spec Spec) serviceAddress() string {
+	if spec.ServiceAddress != "" {
+		return spec.ServiceAddress
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "127.0.0.1"
+	}
+
+	return hostname
+}
+
+// serviceID returns the service id, which falls back to {name}-{address}-{port}.
+func (spec Spec) serviceID() string {
+	if spec.ServiceID != "" {
+		return spec.ServiceID
+	}
+
+	return fmt.Sprintf("%s-%s-%d", spec.ServiceName, spec.serviceAddress(), spec.ServicePort)
+}
+
+// ttl returns the ttl of the check, zero means no ttl check.
+func (spec Spec) ttl() time.Duration {
+	ttl, _ := time.ParseDuration(spec.CheckTTL)
+	return ttl
+}
@@ -19,14 +19,11 @@ package easemesh
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"net/http"
-	"strings"
 	"sync/atomic"
 
+	"github.com/megaease/easeagent-sdk-go/headermatch"
 	"github.com/megaease/easeagent-sdk-go/plugins"
-	"golang.org/x/exp/slices"
 )
 
 const (
@@ -37,6 +34,9 @@ const (
 
 	defaultAgentType    = "GoSDK"
 	defaultAgentVersion = "v0.1.0"
+
+	// forwardedHeadersKey is the key of the headers forwarded along the chain.
+	forwardedHeadersKey = "easeagent.progress.forwarded.headers"
 )
 
 // DefaultSpec returns the default spec of EaseMesh.
@@ -65,15 +65,19 @@ type (
 	EaseMesh struct {
 		spec Spec
 
-		agentInfo []byte
-		headers   atomic.Value // type: []string
+		agentInfo  []byte
+		egressPort int
+		headers    atomic.Value // type: *headermatch.Matcher
 	}
 
 	// Spec is the EaseMesh spec.
 	Spec struct {
 		plugins.BaseSpec `json:",inline"`
 
-		AgentType string `json:"agentType"`
+		AgentType  string `json:"agentType" jsonschema_description:"the type of agent reported to EaseMesh, empty value means GoSDK"`
+		EgressPort int    `json:"egressPort" jsonschema:"minimum=0,maximum=65535" jsonschema_description:"the egress port of the sidecar, zero value means EASEAGENT_EGRESS_PORT or 13002"`
+
+		EgressServices []string `json:"egressServices" jsonschema_description:"the host patterns of the mesh services sent through the sidecar egress, * matches any characters, such as *-mesh"`
 	}
 
 	// AgentInfo stores agent information.
@@ -83,14 +87,23 @@ type (
 	}
 
 	// AgentConfig is the config pushed to agent.
+	//
+	// Deprecated: The config pushed to the agent endpoint /config is applied by
+	// plugins.AgentConfigurer, it is kept for compatibility.
 	AgentConfig struct {
 		Headers string `json:"easeagent.progress.forwarded.headers"`
 	}
+
+	// ForwardedHeadersInfo shows the forwarded headers for debugging.
+	ForwardedHeadersInfo struct {
+		Patterns []string `json:"patterns"`
+		Matched  []string `json:"matched"`
+	}
 )
 
 // Validate validates the EaseMesh spec.
 func (s Spec) Validate() error {
-	return nil
+	return plugins.ValidateSchema(s)
 }
 
 // New creates a EaseMesh plugin.
@@ -113,11 +126,12 @@ func New(pluginSpec plugins.Spec) (plugins.Plugin, error) {
 	}
 
 	mesh := &EaseMesh{
-		agentInfo: buff,
-		spec:      pluginSpec.(Spec),
+		agentInfo:  buff,
+		egressPort: egressPort(spec.EgressPort),
+		spec:       pluginSpec.(Spec),
 	}
 
-	mesh.headers.Store([]string{})
+	mesh.headers.Store(headermatch.MustParse(""))
 
 	return mesh, nil
 }
@@ -130,25 +144,28 @@ func (mesh *EaseMesh) Name() string {
 // HandleAgentRequest handles the agent request.
 func (mesh *EaseMesh) HandleAgentRequest(w http.ResponseWriter, r *http.Request) bool {
 	switch r.URL.Path {
-	case "/config":
-		mesh.handleConfig(w, r)
-		return true
 	case "/agent-info":
 		mesh.handleAgentInfo(w, r)
 		return true
+	case "/forwarded-headers":
+		mesh.handleForwardedHeaders(w, r)
+		return true
 	default:
 		return false
 	}
 }
 
 // WrapUserHandlerFunc wraps the user handler function.
+// The forwarded headers of the request are copied onto the response,
+// and stored in the request context to be injected into the outgoing requests.
 func (mesh *EaseMesh) WrapUserHandlerFunc(fn http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		keys := mesh.headers.Load().([]string)
-		for k, v := range r.Header.Clone() {
-			if slices.Contains(keys, k) {
-				w.Header()[k] = v
+		headers := mesh.forwardedHeaders(r)
+		if len(headers) != 0 {
+			for k, v := range headers {
+				w.Header()[k] = append([]string(nil), v...)
 			}
+			r = r.WithContext(WithForwardedHeaders(r.Context(), headers))
 		}
 
 		fn(w, r)
@@ -158,30 +175,59 @@ func (mesh *EaseMesh) WrapUserHandlerFunc(fn http.HandlerFunc) http.HandlerFunc
 	}
 }
 
-func (mesh *EaseMesh) handleConfig(w http.ResponseWriter, r *http.Request) {
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		log.Printf("read config body failed: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
-		return
+// ApplyAgentConfig applies the forwarded headers pushed to the agent endpoint /config.
+func (mesh *EaseMesh) ApplyAgentConfig(config map[string]string) error {
+	value, exists := config[forwardedHeadersKey]
+	if !exists {
+		return nil
 	}
 
-	config := &AgentConfig{}
-	err = json.Unmarshal(body, config)
+	matcher, err := headermatch.Parse(value)
 	if err != nil {
-		log.Printf("unmarshal config body failed: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
-		return
+		return err
+	}
+	mesh.headers.Store(matcher)
+
+	return nil
+}
+
+// ValidateAgentConfig validates the forwarded headers pushed to the agent endpoint /config.
+func (mesh *EaseMesh) ValidateAgentConfig(config map[string]string) error {
+	value, exists := config[forwardedHeadersKey]
+	if !exists {
+		return nil
 	}
 
-	headers := strings.Split(config.Headers, ",")
-	mesh.headers.Store(headers)
+	_, err := headermatch.Parse(value)
+	return err
+}
+
+// AgentConfig returns the current forwarded headers.
+func (mesh *EaseMesh) AgentConfig() map[string]string {
+	return map[string]string{
+		forwardedHeadersKey: mesh.matcher().String(),
+	}
+}
+
+func (mesh *EaseMesh) matcher() *headermatch.Matcher {
+	return mesh.headers.Load().(*headermatch.Matcher)
 }
 
 func (mesh *EaseMesh) handleAgentInfo(w http.ResponseWriter, r *http.Request) {
 	w.Write(mesh.agentInfo)
 }
 
+func (mesh *EaseMesh) handleForwardedHeaders(w http.ResponseWriter, r *http.Request) {
+	matcher := mesh.matcher()
+	info := &ForwardedHeadersInfo{
+		Patterns: matcher.Patterns(),
+		Matched:  matcher.Matched(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
 // Close closes the EaseMesh plugin.
 func (mesh *EaseMesh) Close() error {
 	return nil
@@ -0,0 +1,145 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package easemesh
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+)
+
+func newTestEaseMesh(t *testing.T, headers string) *EaseMesh {
+	plugin, err := New(DefaultSpec())
+	assert.Nil(t, err)
+
+	mesh := plugin.(*EaseMesh)
+	assert.Nil(t, mesh.ApplyAgentConfig(map[string]string{forwardedHeadersKey: headers}))
+
+	return mesh
+}
+
+type doerFunc func(req *http.Request) (*http.Response, error)
+
+func (fn doerFunc) Do(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	mesh := newTestEaseMesh(t, "x-canary, X-Location")
+
+	var ctx context.Context
+	handler := mesh.WrapUserHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Canary", "android")
+	req.Header.Set("X-Other", "other")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	assert.Equal(t, http.Header{"X-Canary": {"android"}}, ForwardedHeaders(ctx))
+	assert.Equal(t, "android", w.Header().Get("X-Canary"))
+	assert.Empty(t, w.Header().Get("X-Other"))
+
+	// Without forwarded headers, the context is left untouched.
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Nil(t, ForwardedHeaders(ctx))
+	assert.Nil(t, ForwardedHeaders(nil))
+}
+
+func TestForwardedHeadersConfig(t *testing.T) {
+	mesh := newTestEaseMesh(t, "x-canary, X-Mesh-*")
+	assert.Equal(t, "X-Canary,X-Mesh-*", mesh.AgentConfig()[forwardedHeadersKey])
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Mesh-Zone", "beijing")
+	mesh.WrapUserHandlerFunc(func(w http.ResponseWriter, r *http.Request) {})(httptest.NewRecorder(), req)
+
+	w := httptest.NewRecorder()
+	assert.True(t, mesh.HandleAgentRequest(w, httptest.NewRequest(http.MethodGet, "/forwarded-headers", nil)))
+	assert.JSONEq(t, `{"patterns":["X-Canary","X-Mesh-*"],"matched":["X-Mesh-Zone"]}`, w.Body.String())
+
+	err := mesh.ApplyAgentConfig(map[string]string{forwardedHeadersKey: "/(/"})
+	assert.NotNil(t, err)
+	assert.Equal(t, "X-Canary,X-Mesh-*", mesh.AgentConfig()[forwardedHeadersKey])
+}
+
+func TestWrapUserClient(t *testing.T) {
+	mesh := newTestEaseMesh(t, "X-Canary")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Canary")))
+	}))
+	defer server.Close()
+
+	ctx := WithForwardedHeaders(context.Background(), http.Header{"X-Canary": {"android"}})
+
+	client := mesh.WrapUserClient(server.Client())
+	_, ok := client.(*http.Client)
+	assert.True(t, ok, "*http.Client must stay a *http.Client for other plugins")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	assert.Nil(t, err)
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	body := make([]byte, 16)
+	n, _ := resp.Body.Read(body)
+	resp.Body.Close()
+	assert.Equal(t, "android", string(body[:n]))
+	assert.Empty(t, req.Header.Get("X-Canary"), "the user's request must not be modified")
+
+	var got *http.Request
+	doer := mesh.WrapUserClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		got = req
+		return nil, nil
+	}))
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	assert.Nil(t, err)
+	req.Header.Set("X-Canary", "ios")
+	doer.Do(req)
+	assert.Equal(t, "ios", got.Header.Get("X-Canary"), "headers set by the user are not overridden")
+}
+
+func TestWrapUserClientRequest(t *testing.T) {
+	mesh := newTestEaseMesh(t, "X-Canary,X-Location")
+
+	parent := WithForwardedHeaders(context.Background(), http.Header{
+		"X-Canary":   {"android"},
+		"X-Location": {"beijing"},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Location", "shanghai")
+	wrapped := mesh.WrapUserClientRequest(parent, req)
+
+	assert.Equal(t, "android", wrapped.Header.Get("X-Canary"))
+	assert.Equal(t, "shanghai", wrapped.Header.Get("X-Location"))
+	assert.NotNil(t, ForwardedHeaders(wrapped.Context()))
+
+	assert.Same(t, req, mesh.WrapUserClientRequest(context.Background(), req))
+}
+
+var (
+	_ plugins.UserClientWrapper        = &EaseMesh{}
+	_ plugins.UserClientRequestWrapper = &EaseMesh{}
+)
@@ -0,0 +1,160 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package easemesh
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultEgressPort is the default egress port of the EaseMesh sidecar.
+	DefaultEgressPort = 13002
+
+	// EgressPortEnv is the environment variable of the egress port,
+	// which is used if the port is not specified in spec.
+	EgressPortEnv = "EASEAGENT_EGRESS_PORT"
+
+	egressHost = "127.0.0.1"
+)
+
+type (
+	// EgressTransport routes the plain http requests of the mesh services such as
+	// http://delivery-mesh/api through the egress port of the local sidecar,
+	// the service name is kept in the Host header for the sidecar to route.
+	// The https requests and the requests to other hosts, IP addresses and localhost
+	// are sent directly.
+	EgressTransport struct {
+		// Port is the egress port, zero value means the port of the EaseMesh plugin
+		// if the client is wrapped by the agent, otherwise EgressPortEnv or DefaultEgressPort.
+		Port int
+		// Services are the host patterns of the mesh services, * matches any characters,
+		// such as delivery-mesh and *-mesh. Empty value means the egressServices of
+		// the EaseMesh plugin if the client is wrapped by the agent.
+		Services []string
+		// Base is the underlying transport, nil means http.DefaultTransport.
+		Base http.RoundTripper
+
+		// portOnce resolves the port once, which might read the environment variable.
+		portOnce sync.Once
+		port     int
+	}
+)
+
+// NewEgressClient returns the client sending the requests of the services through
+// the sidecar egress, wrap it by agent.WrapUserClient to apply tracing and forwarded headers:
+//
+//	client := a.WrapUserClient(easemesh.NewEgressClient("*-mesh"))
+//	req, _ := http.NewRequest(http.MethodGet, "http://delivery-mesh/api", nil)
+//	resp, err := client.Do(a.WrapHTTPRequest(serverReq.Context(), req))
+//
+// Empty services means the egressServices of the EaseMesh plugin wrapping it.
+func NewEgressClient(services ...string) *http.Client {
+	return &http.Client{
+		Transport: &EgressTransport{Services: services},
+	}
+}
+
+// egressPort returns the egress port of spec, which falls back to
+// EgressPortEnv and DefaultEgressPort in turn.
+func egressPort(port int) int {
+	if port != 0 {
+		return port
+	}
+
+	value := os.Getenv(EgressPortEnv)
+	if value == "" {
+		return DefaultEgressPort
+	}
+
+	port, err := strconv.Atoi(value)
+	if err != nil || port <= 0 || port > 65535 {
+		log.Printf("invalid %s %q, use %d", EgressPortEnv, value, DefaultEgressPort)
+		return DefaultEgressPort
+	}
+
+	return port
+}
+
+// withDefaults returns the copy of transport using the port and services of the plugin
+// if they are not specified.
+func (t *EgressTransport) withDefaults(port int, services []string) *EgressTransport {
+	if t.Port != 0 && len(t.Services) != 0 {
+		return t
+	}
+
+	copied := &EgressTransport{Port: t.Port, Services: t.Services, Base: t.Base}
+	if copied.Port == 0 {
+		copied.Port = port
+	}
+	if len(copied.Services) == 0 {
+		copied.Services = services
+	}
+
+	return copied
+}
+
+// egressPort returns the resolved egress port.
+func (t *EgressTransport) egressPort() int {
+	t.portOnce.Do(func() {
+		t.port = egressPort(t.Port)
+	})
+
+	return t.port
+}
+
+// isService returns true if the hostname matches any of the services.
+func (t *EgressTransport) isService(hostname string) bool {
+	if hostname == "" || hostname == "localhost" || net.ParseIP(hostname) != nil {
+		return false
+	}
+
+	hostname = strings.ToLower(hostname)
+	for _, pattern := range t.Services {
+		if matched, _ := path.Match(strings.ToLower(pattern), hostname); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *EgressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// NOTE: The https requests are never downgraded to the plain sidecar egress.
+	hostname := req.URL.Hostname()
+	if req.URL.Scheme != "http" || !t.isService(hostname) {
+		return base.RoundTrip(req)
+	}
+
+	outreq := req.Clone(req.Context())
+	outreq.Host = hostname
+	outreq.URL.Host = net.JoinHostPort(egressHost, strconv.Itoa(t.egressPort()))
+
+	return base.RoundTrip(outreq)
+}
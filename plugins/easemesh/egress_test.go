@@ -0,0 +1,154 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package easemesh
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeSidecar returns the fake egress of sidecar which responds the host and path, and its port.
+func newFakeSidecar(t *testing.T) (*httptest.Server, int) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + r.URL.Path + " " + r.Header.Get("X-Canary")))
+	}))
+
+	u, err := url.Parse(server.URL)
+	assert.Nil(t, err)
+	port, err := strconv.Atoi(u.Port())
+	assert.Nil(t, err)
+
+	return server, port
+}
+
+func doGet(t *testing.T, client interface {
+	Do(*http.Request) (*http.Response, error)
+}, ctx context.Context, url string) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	assert.Nil(t, err)
+
+	resp, err := client.Do(req)
+	if !assert.Nil(t, err) {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+
+	return string(body)
+}
+
+func TestEgressTransport(t *testing.T) {
+	sidecar, port := newFakeSidecar(t)
+	defer sidecar.Close()
+
+	client := &http.Client{Transport: &EgressTransport{Port: port, Services: []string{"*-MESH"}}}
+	assert.Equal(t, "delivery-mesh/api ", doGet(t, client, context.Background(), "http://delivery-mesh/api"))
+	assert.Equal(t, "delivery-mesh/api ", doGet(t, client, context.Background(), "http://delivery-mesh:8080/api"))
+
+	// The requests to IP addresses are sent directly.
+	client = &http.Client{Transport: &EgressTransport{Port: 1, Services: []string{"*"}}}
+	assert.Equal(t, sidecar.Listener.Addr().String()+"/api ", doGet(t, client, context.Background(), sidecar.URL+"/api"))
+
+	t.Setenv(EgressPortEnv, strconv.Itoa(port))
+	assert.Equal(t, "restaurant-mesh/ ", doGet(t, NewEgressClient("restaurant-mesh"), context.Background(), "http://restaurant-mesh/"))
+
+	t.Setenv(EgressPortEnv, "invalid")
+	assert.Equal(t, DefaultEgressPort, egressPort(0))
+	assert.Equal(t, 13003, egressPort(13003))
+}
+
+func TestEgressTransportPassThrough(t *testing.T) {
+	var routed []string
+	transport := &EgressTransport{
+		Services: []string{"*-mesh"},
+		Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			routed = append(routed, req.URL.String()+" "+req.Host)
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		}),
+	}
+
+	t.Setenv(EgressPortEnv, "13005")
+	for _, u := range []string{
+		"http://delivery-mesh/api",
+		"https://delivery-mesh/api",
+		"http://api.example.com/v1",
+		"http://localhost:8080/",
+	} {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		assert.Nil(t, err)
+		_, err = transport.RoundTrip(req)
+		assert.Nil(t, err)
+	}
+
+	// The port is resolved once.
+	t.Setenv(EgressPortEnv, "13006")
+	req, err := http.NewRequest(http.MethodGet, "http://order-mesh/", nil)
+	assert.Nil(t, err)
+	_, err = transport.RoundTrip(req)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{
+		"http://127.0.0.1:13005/api delivery-mesh",
+		"https://delivery-mesh/api delivery-mesh",
+		"http://api.example.com/v1 api.example.com",
+		"http://localhost:8080/ localhost:8080",
+		"http://127.0.0.1:13005/ order-mesh",
+	}, routed)
+
+	// No services routes nothing.
+	routed = nil
+	req, err = http.NewRequest(http.MethodGet, "http://delivery-mesh/api", nil)
+	assert.Nil(t, err)
+	_, err = (&EgressTransport{Base: transport.Base}).RoundTrip(req)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http://delivery-mesh/api delivery-mesh"}, routed)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestEgressClient(t *testing.T) {
+	sidecar, port := newFakeSidecar(t)
+	defer sidecar.Close()
+
+	spec := DefaultSpec().(Spec)
+	spec.EgressPort = port
+	spec.EgressServices = []string{"*-mesh"}
+	plugin, err := New(spec)
+	assert.Nil(t, err)
+	mesh := plugin.(*EaseMesh)
+
+	ctx := WithForwardedHeaders(context.Background(), http.Header{"X-Canary": {"android"}})
+	client := mesh.WrapUserClient(NewEgressClient())
+	assert.Equal(t, "delivery-mesh/api android", doGet(t, client, ctx, "http://delivery-mesh/api"))
+
+	// The services of the client win.
+	client = mesh.WrapUserClient(NewEgressClient("order-mesh"))
+	assert.Equal(t, "order-mesh/api android", doGet(t, client, ctx, "http://order-mesh/api"))
+}
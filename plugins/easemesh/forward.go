@@ -0,0 +1,129 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package easemesh
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+)
+
+type (
+	forwardedHeadersContextKey struct{}
+
+	// clientWrapper injects the forwarded headers into the requests of a plugins.HTTPDoer.
+	clientWrapper struct {
+		httpDoer plugins.HTTPDoer
+	}
+
+	// transport injects the forwarded headers into the requests of a *http.Client.
+	transport struct {
+		base http.RoundTripper
+	}
+)
+
+// WithForwardedHeaders returns a copy of ctx carrying the forwarded headers.
+func WithForwardedHeaders(ctx context.Context, headers http.Header) context.Context {
+	return context.WithValue(ctx, forwardedHeadersContextKey{}, headers)
+}
+
+// ForwardedHeaders returns the forwarded headers of the inbound request carried by ctx.
+// It returns nil if there are none.
+func ForwardedHeaders(ctx context.Context) http.Header {
+	if ctx == nil {
+		return nil
+	}
+
+	headers, _ := ctx.Value(forwardedHeadersContextKey{}).(http.Header)
+	return headers
+}
+
+// forwardedHeaders returns the headers of req which should be forwarded along the chain.
+func (mesh *EaseMesh) forwardedHeaders(req *http.Request) http.Header {
+	return mesh.matcher().Filter(req.Header)
+}
+
+// injectForwardedHeaders returns the request carrying the forwarded headers,
+// the headers already set in req are not overridden.
+// It returns req itself if there is nothing to inject.
+func injectForwardedHeaders(req *http.Request, headers http.Header) *http.Request {
+	cloned := false
+	for key, values := range headers {
+		if _, exists := req.Header[key]; exists {
+			continue
+		}
+
+		if !cloned {
+			req = req.Clone(req.Context())
+			cloned = true
+		}
+		req.Header[key] = append([]string(nil), values...)
+	}
+
+	return req
+}
+
+// WrapUserClient wraps the user's client to inject the forwarded headers
+// carried by the request context into every outgoing request.
+// The *http.Client is wrapped in its transport to stay a *http.Client for other plugins,
+// and its EgressTransport uses the egress port and services of the plugin if not specified.
+func (mesh *EaseMesh) WrapUserClient(c plugins.HTTPDoer) plugins.HTTPDoer {
+	if original, ok := c.(*http.Client); ok {
+		base := original.Transport
+		if egress, ok := base.(*EgressTransport); ok {
+			base = egress.withDefaults(mesh.egressPort, mesh.spec.EgressServices)
+		}
+
+		client := *original
+		client.Transport = &transport{base: base}
+		return &client
+	}
+
+	return &clientWrapper{httpDoer: c}
+}
+
+// WrapUserClientRequest wraps the user's http request with the forwarded headers
+// of the inbound request carried by current.
+func (mesh *EaseMesh) WrapUserClientRequest(current context.Context, req *http.Request) *http.Request {
+	headers := ForwardedHeaders(current)
+	if len(headers) == 0 {
+		return req
+	}
+
+	req = injectForwardedHeaders(req, headers)
+	if ForwardedHeaders(req.Context()) == nil {
+		req = req.WithContext(WithForwardedHeaders(req.Context(), headers))
+	}
+
+	return req
+}
+
+// Do implements plugins.HTTPDoer.
+func (c *clientWrapper) Do(req *http.Request) (*http.Response, error) {
+	return c.httpDoer.Do(injectForwardedHeaders(req, ForwardedHeaders(req.Context())))
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return base.RoundTrip(injectForwardedHeaders(req, ForwardedHeaders(req.Context())))
+}
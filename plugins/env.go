@@ -0,0 +1,281 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugins
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// EnvPrefix is the prefix of environment variables overriding config keys.
+const EnvPrefix = "EASEAGENT_"
+
+var stringType = reflect.TypeOf("")
+
+type (
+	// EnvLookup looks up the environment variable, os.LookupEnv is the default one.
+	EnvLookup func(key string) (string, bool)
+
+	// field is a config field which could be set by its key.
+	field struct {
+		key   string
+		value reflect.Value
+		tag   reflect.StructTag
+	}
+)
+
+// EnvKey returns the environment variable of the config key, the dots and
+// the word boundaries of camel case become underscores, for example:
+//
+//	tracing.sample.rate -> EASEAGENT_TRACING_SAMPLE_RATE
+//	serviceName -> EASEAGENT_SERVICE_NAME
+//	reporter.output.server.tls.caCert -> EASEAGENT_REPORTER_OUTPUT_SERVER_TLS_CA_CERT
+func EnvKey(key string) string {
+	var b strings.Builder
+	b.WriteString(EnvPrefix)
+
+	runes := []rune(key)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			b.WriteRune('_')
+		case unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])):
+			b.WriteRune('_')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+
+	return b.String()
+}
+
+// Keys returns the config keys of the struct which could be set by environment variables,
+// the keys are the json tags of the fields except the ones of BaseSpec.
+func Keys(v interface{}) []string {
+	var keys []string
+	for _, f := range fieldsOf(reflect.New(reflect.TypeOf(v)).Elem()) {
+		keys = append(keys, f.key)
+	}
+
+	return keys
+}
+
+// ApplyEnv sets the fields of the struct pointed by ptr with environment variables,
+// please see EnvKey for the names. It sets all valid values and reports the invalid ones.
+// The supported types are string, bool, numbers, time.Duration, []string in the form
+// of "a,b", and map[string]string in the form of "k1=v1,k2=v2".
+func ApplyEnv(ptr interface{}, lookup EnvLookup) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%T is not a pointer to struct", ptr)
+	}
+
+	var msgs []string
+	for _, f := range fieldsOf(v.Elem()) {
+		envKey := EnvKey(f.key)
+		s, exists := lookup(envKey)
+		if !exists {
+			continue
+		}
+
+		err := setValue(f.value, s)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("invalid %s=%q for %s: %v", envKey, s, f.key, err))
+		}
+	}
+
+	if len(msgs) != 0 {
+		return fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+
+	return nil
+}
+
+// EnvValues returns the values of environment variables keyed by the config keys
+// of the struct v, which are parsed in the types of the fields, please see ApplyEnv.
+// It returns the valid values along with the error of the invalid ones.
+func EnvValues(v interface{}, lookup EnvLookup) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+
+	var msgs []string
+	for _, f := range fieldsOf(reflect.New(reflect.TypeOf(v)).Elem()) {
+		envKey := EnvKey(f.key)
+		s, exists := lookup(envKey)
+		if !exists {
+			continue
+		}
+
+		err := setValue(f.value, s)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("invalid %s=%q for %s: %v", envKey, s, f.key, err))
+			continue
+		}
+		values[f.key] = f.value.Interface()
+	}
+
+	if len(msgs) != 0 {
+		return values, fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+
+	return values, nil
+}
+
+// ApplyEnvToSpec returns a copy of the spec overridden by environment variables,
+// the spec of pointer type is copied to a new pointer, please see ApplyEnv for details.
+func ApplyEnvToSpec(spec Spec, lookup EnvLookup) (Spec, error) {
+	v := reflect.ValueOf(spec)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		ptr := reflect.New(v.Elem().Type())
+		ptr.Elem().Set(v.Elem())
+		err := ApplyEnv(ptr.Interface(), lookup)
+
+		return ptr.Interface().(Spec), err
+	}
+
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	err := ApplyEnv(ptr.Interface(), lookup)
+
+	return ptr.Elem().Interface().(Spec), err
+}
+
+// fieldsOf returns the fields of the struct value recursively, which could be
+// set by environment variables.
+func fieldsOf(v reflect.Value) []*field {
+	var fields []*field
+	for _, f := range jsonFieldsOf(v) {
+		if f.tag.Get("json") != "" && isSupported(f.value.Type()) {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+// jsonFieldsOf returns the fields of the struct value marshaled by json recursively,
+// except the ones of BaseSpec.
+func jsonFieldsOf(v reflect.Value) []*field {
+	var fields []*field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() || sf.Type == reflect.TypeOf(BaseSpec{}) {
+			continue
+		}
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFieldsOf(v.Field(i))...)
+			continue
+		}
+
+		key := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = sf.Name
+		}
+
+		fields = append(fields, &field{key: key, value: v.Field(i), tag: sf.Tag})
+	}
+
+	return fields
+}
+
+func isSupported(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Slice:
+		return t.Elem() == stringType
+	case reflect.Map:
+		return t.Key() == stringType && t.Elem() == stringType
+	default:
+		return false
+	}
+}
+
+func setValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("want bool")
+		}
+		v.SetBool(b)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("want %s", v.Type())
+		}
+		v.SetFloat(f)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("want duration such as 10s")
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("want %s", v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("want %s", v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Slice:
+		items := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items).Convert(v.Type()))
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		for _, pair := range strings.Split(s, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("want k1=v1,k2=v2")
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(kv[0])), reflect.ValueOf(strings.TrimSpace(kv[1])))
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugins
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type envSpec struct {
+	BaseSpec `json:",inline"`
+
+	Rate     float64           `json:"tracing.sample.rate"`
+	Enable   bool              `json:"tracing.enable"`
+	Service  string            `json:"serviceName"`
+	CaCert   string            `json:"reporter.output.server.tls.caCert"`
+	Port     uint16            `json:"port"`
+	Timeout  time.Duration     `json:"timeout"`
+	Headers  []string          `json:"headers"`
+	Tags     map[string]string `json:"tags"`
+	Ignored  string            `json:"-"`
+	Internal func()            `json:"internal"`
+}
+
+func (s envSpec) Validate() error { return nil }
+
+func lookupMap(m map[string]string) EnvLookup {
+	return func(key string) (string, bool) {
+		v, ok := m[key]
+		return v, ok
+	}
+}
+
+func TestEnvKey(t *testing.T) {
+	assert.Equal(t, "EASEAGENT_TRACING_SAMPLE_RATE", EnvKey("tracing.sample.rate"))
+	assert.Equal(t, "EASEAGENT_SERVICE_NAME", EnvKey("serviceName"))
+	assert.Equal(t, "EASEAGENT_REPORTER_OUTPUT_SERVER_TLS_CA_CERT", EnvKey("reporter.output.server.tls.caCert"))
+	assert.Equal(t, "EASEAGENT_TRACING_ID128BIT", EnvKey("tracing.id128bit"))
+	assert.Equal(t, "EASEAGENT_ADDRESS", EnvKey("address"))
+}
+
+func TestKeys(t *testing.T) {
+	assert.Equal(t, []string{
+		"tracing.sample.rate", "tracing.enable", "serviceName", "reporter.output.server.tls.caCert",
+		"port", "timeout", "headers", "tags",
+	}, Keys(envSpec{}))
+}
+
+func TestApplyEnvToSpec(t *testing.T) {
+	spec := envSpec{BaseSpec: BaseSpec{NameField: "test"}, Rate: 1, Service: "old"}
+	newSpec, err := ApplyEnvToSpec(spec, lookupMap(map[string]string{
+		"EASEAGENT_TRACING_SAMPLE_RATE":                "0.5",
+		"EASEAGENT_TRACING_ENABLE":                     "true",
+		"EASEAGENT_SERVICE_NAME":                       "new",
+		"EASEAGENT_REPORTER_OUTPUT_SERVER_TLS_CA_CERT": "ca",
+		"EASEAGENT_PORT":                               "8080",
+		"EASEAGENT_TIMEOUT":                            "3s",
+		"EASEAGENT_HEADERS":                            "X-A, X-B",
+		"EASEAGENT_TAGS":                               "env=prod, zone=a",
+		"EASEAGENT_NAME":                               "ignored",
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, envSpec{
+		BaseSpec: BaseSpec{NameField: "test"},
+		Rate:     0.5,
+		Enable:   true,
+		Service:  "new",
+		CaCert:   "ca",
+		Port:     8080,
+		Timeout:  3 * time.Second,
+		Headers:  []string{"X-A", "X-B"},
+		Tags:     map[string]string{"env": "prod", "zone": "a"},
+	}, newSpec)
+
+	// The original spec is not changed.
+	assert.Equal(t, "old", spec.Service)
+
+	// The spec of pointer type is copied too.
+	ptrSpec := &envSpec{BaseSpec: BaseSpec{NameField: "test"}, Service: "old"}
+	newSpec, err = ApplyEnvToSpec(ptrSpec, lookupMap(map[string]string{"EASEAGENT_SERVICE_NAME": "new"}))
+	assert.Nil(t, err)
+	assert.Equal(t, "new", newSpec.(*envSpec).Service)
+	assert.NotSame(t, ptrSpec, newSpec)
+	assert.Equal(t, "old", ptrSpec.Service)
+}
+
+func TestApplyEnvErrors(t *testing.T) {
+	spec := &envSpec{}
+	err := ApplyEnv(spec, lookupMap(map[string]string{
+		"EASEAGENT_TRACING_SAMPLE_RATE": "high",
+		"EASEAGENT_TRACING_ENABLE":      "yes",
+		"EASEAGENT_PORT":                "65536",
+		"EASEAGENT_SERVICE_NAME":        "valid",
+	}))
+	assert.EqualError(t, err, `invalid EASEAGENT_TRACING_SAMPLE_RATE="high" for tracing.sample.rate: want float64; `+
+		`invalid EASEAGENT_TRACING_ENABLE="yes" for tracing.enable: want bool; `+
+		`invalid EASEAGENT_PORT="65536" for port: want uint16`)
+	assert.Equal(t, "valid", spec.Service)
+
+	assert.NotNil(t, ApplyEnv(envSpec{}, lookupMap(nil)))
+}
+
+func TestEnvValues(t *testing.T) {
+	values, err := EnvValues(envSpec{}, lookupMap(map[string]string{
+		"EASEAGENT_TRACING_SAMPLE_RATE": "0.5",
+		"EASEAGENT_TRACING_ENABLE":      "yes",
+		"EASEAGENT_HEADERS":             "X-A,X-B",
+	}))
+	assert.EqualError(t, err, `invalid EASEAGENT_TRACING_ENABLE="yes" for tracing.enable: want bool`)
+	assert.Equal(t, map[string]interface{}{
+		"tracing.sample.rate": 0.5,
+		"headers":             []string{"X-A", "X-B"},
+	}, values)
+}
@@ -0,0 +1,120 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RedactedValue is the value replacing secrets.
+const RedactedValue = "******"
+
+// secretSuffixes are the suffixes of lowercase keys whose values are secrets.
+var secretSuffixes = []string{"password", "secret", "token", ".key", "privatekey"}
+
+// IsSecretKey returns whether the value of the spec key is secret,
+// such as reporter.output.server.auth.password and reporter.output.server.tls.key.
+func IsSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, suffix := range secretSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RedactSpec returns the spec in JSON object, whose non-empty secret values are redacted.
+func RedactSpec(spec Spec) (map[string]interface{}, error) {
+	buff, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %T failed: %v", spec, err)
+	}
+
+	var m map[string]interface{}
+	err = json.Unmarshal(buff, &m)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s to %T failed: %v", buff, m, err)
+	}
+
+	Redact(m)
+
+	return m, nil
+}
+
+// Redact redacts the non-empty secret values of the JSON object recursively,
+// including the objects in arrays.
+func Redact(m map[string]interface{}) {
+	for k, v := range m {
+		if child, ok := v.(map[string]interface{}); ok {
+			Redact(child)
+			continue
+		}
+
+		if v != nil && v != "" && IsSecretKey(k) {
+			m[k] = RedactedValue
+			continue
+		}
+
+		if items, ok := v.([]interface{}); ok {
+			redactItems(items)
+		}
+	}
+}
+
+// redactItems redacts the objects in the JSON array recursively.
+func redactItems(items []interface{}) {
+	for _, item := range items {
+		switch item := item.(type) {
+		case map[string]interface{}:
+			Redact(item)
+		case []interface{}:
+			redactItems(item)
+		}
+	}
+}
+
+// Capabilities returns the names of capability interfaces implemented by the plugin.
+func Capabilities(plug Plugin) []string {
+	capabilities := []string{}
+	if _, ok := plug.(AgentHandler); ok {
+		capabilities = append(capabilities, "AgentHandler")
+	}
+	if _, ok := plug.(UserHandlerFuncWrapper); ok {
+		capabilities = append(capabilities, "UserHandlerFuncWrapper")
+	}
+	if _, ok := plug.(UserClientWrapper); ok {
+		capabilities = append(capabilities, "UserClientWrapper")
+	}
+	if _, ok := plug.(UserClientRequestWrapper); ok {
+		capabilities = append(capabilities, "UserClientRequestWrapper")
+	}
+	if _, ok := plug.(Reloader); ok {
+		capabilities = append(capabilities, "Reloader")
+	}
+	if _, ok := plug.(AgentConfigurer); ok {
+		capabilities = append(capabilities, "AgentConfigurer")
+	}
+	if _, ok := plug.(AgentConfigValidator); ok {
+		capabilities = append(capabilities, "AgentConfigValidator")
+	}
+
+	return capabilities
+}
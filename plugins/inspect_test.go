@@ -0,0 +1,64 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugins
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSecretKey(t *testing.T) {
+	assert.True(t, IsSecretKey("reporter.output.server.auth.password"))
+	assert.True(t, IsSecretKey("reporter.output.server.tls.key"))
+	assert.True(t, IsSecretKey("registry.token"))
+	assert.False(t, IsSecretKey("reporter.output.server.tls.cert"))
+	assert.False(t, IsSecretKey("reporter.output.server.auth.username"))
+	assert.False(t, IsSecretKey("kind"))
+}
+
+func TestRedact(t *testing.T) {
+	m := map[string]interface{}{
+		"name":     "test",
+		"password": "secret",
+		"token":    "",
+		"nested": map[string]interface{}{
+			"tls.key": "key",
+			"port":    80,
+		},
+		"plugins": []interface{}{
+			map[string]interface{}{"consul.token": "token", "name": "consul"},
+			[]interface{}{map[string]interface{}{"password": "secret"}},
+			"item",
+		},
+	}
+	Redact(m)
+	assert.Equal(t, map[string]interface{}{
+		"name":     "test",
+		"password": RedactedValue,
+		"token":    "",
+		"nested": map[string]interface{}{
+			"tls.key": RedactedValue,
+			"port":    80,
+		},
+		"plugins": []interface{}{
+			map[string]interface{}{"consul.token": RedactedValue, "name": "consul"},
+			[]interface{}{map[string]interface{}{"password": RedactedValue}},
+			"item",
+		},
+	}, m)
+}
@@ -21,6 +21,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
 )
 
 type (
@@ -52,6 +54,33 @@ type (
 		WrapUserClientRequest(parent context.Context, req *http.Request) *http.Request
 	}
 
+	// Reloader is the plugin which is able to apply a new spec in place,
+	// so the references of the plugin held by users are still valid.
+	// The plugins which are not Reloader will be rebuilt when their specs change.
+	Reloader interface {
+		// Reload must apply the whole spec or nothing.
+		// NOTE: The spec has the same type and name with the current one.
+		Reload(spec Spec) error
+	}
+
+	// AgentConfigurer is the plugin which accepts the config pushed to the agent
+	// endpoint /config, such as by EaseMesh control plane. The config is keyed by
+	// the flat config keys such as tracing.sample.rate, and the values are strings.
+	AgentConfigurer interface {
+		// ApplyAgentConfig applies the keys it understands and ignores the others,
+		// it must apply all of its keys or nothing.
+		ApplyAgentConfig(config map[string]string) error
+		// AgentConfig returns the current effective values of the keys it understands.
+		AgentConfig() map[string]string
+	}
+
+	// AgentConfigValidator is the AgentConfigurer which validates the config without
+	// applying it, so the config pushed to /config is applied to all plugins or none.
+	AgentConfigValidator interface {
+		// ValidateAgentConfig returns the error which ApplyAgentConfig would return.
+		ValidateAgentConfig(config map[string]string) error
+	}
+
 	// HTTPDoer is the interface to do HTTP request.
 	HTTPDoer interface {
 		Do(req *http.Request) (*http.Response, error)
@@ -76,6 +105,15 @@ type (
 		// NewInstance creates a new plugin instance for the kind.
 		// NOTE: The spec has the same type with the one which DefaultSpec returns.
 		NewInstance func(spec Spec) (Plugin, error)
+
+		// Priority decides the load order of plugins which don't depend on each other,
+		// the plugin with smaller priority is loaded earlier, and the ones with the same
+		// priority keep the order in config. The plugins loaded earlier wrap the user
+		// handlers and clients earlier, which means they run inside the later ones.
+		Priority int
+
+		// DependsOn is the kinds of plugins which must be loaded before the plugin.
+		DependsOn []string
 	}
 
 	// Spec is the common interface of filter specs
@@ -120,8 +158,14 @@ func Register(cons *Constructor) {
 	constructors[cons.Kind] = cons
 }
 
-// NewFromJSON creates a plugin instance according to the JSON spec.
-func NewFromJSON(specJSON []byte) (Plugin, error) {
+// GetConstructor returns the constructor of the kind, it returns nil if not found.
+func GetConstructor(kind string) *Constructor {
+	return constructors[kind]
+}
+
+// NewSpecFromJSON creates a spec according to the JSON spec, the kind of
+// the JSON spec is required, and the absent keys are the ones of DefaultSpec.
+func NewSpecFromJSON(specJSON []byte) (Spec, error) {
 	var baseSpec BaseSpec
 	if err := json.Unmarshal(specJSON, &baseSpec); err != nil {
 		return nil, fmt.Errorf("unmarshal %s to %T failed: %v", specJSON, baseSpec, err)
@@ -132,10 +176,23 @@ func NewFromJSON(specJSON []byte) (Plugin, error) {
 		return nil, fmt.Errorf("plugin kind %s not found", baseSpec.KindField)
 	}
 
-	spec := cons.DefaultSpec()
+	// NOTE: Unmarshal into the pointer to the concrete type of the default spec,
+	// the pointer to Spec interface makes json replace it with a map.
+	defaultSpec := cons.DefaultSpec()
+	v := reflect.New(reflect.TypeOf(defaultSpec))
+	v.Elem().Set(reflect.ValueOf(defaultSpec))
+	if err := json.Unmarshal(specJSON, v.Interface()); err != nil {
+		return nil, fmt.Errorf("unmarshal %s to %T failed: %v", specJSON, defaultSpec, err)
+	}
+
+	return v.Elem().Interface().(Spec), nil
+}
 
-	if err := json.Unmarshal(specJSON, &spec); err != nil {
-		return nil, fmt.Errorf("unmarshal %s to %T failed: %v", specJSON, spec, err)
+// NewFromJSON creates a plugin instance according to the JSON spec.
+func NewFromJSON(specJSON []byte) (Plugin, error) {
+	spec, err := NewSpecFromJSON(specJSON)
+	if err != nil {
+		return nil, err
 	}
 
 	return New(spec)
@@ -165,6 +222,68 @@ func New(spec Spec) (Plugin, error) {
 	return instance, nil
 }
 
+// SortSpecs sorts the specs in load order, which follows the dependencies and
+// priorities of their constructors, please see Constructor for details.
+// It returns error if the kind is not found, any dependency is missing or cyclic.
+func SortSpecs(specs []Spec) ([]Spec, error) {
+	kinds := map[string][]int{}
+	for i, spec := range specs {
+		if constructors[spec.Kind()] == nil {
+			return nil, fmt.Errorf("plugin kind %s not found", spec.Kind())
+		}
+		kinds[spec.Kind()] = append(kinds[spec.Kind()], i)
+	}
+
+	// dependents[i] are the indexes of specs depending on specs[i],
+	// inDegrees[i] is the count of specs which specs[i] depends on.
+	dependents := make([][]int, len(specs))
+	inDegrees := make([]int, len(specs))
+	for i, spec := range specs {
+		for _, kind := range constructors[spec.Kind()].DependsOn {
+			deps, exists := kinds[kind]
+			if !exists {
+				return nil, fmt.Errorf("plugin %s depends on kind %s which is not loaded", spec.Name(), kind)
+			}
+			for _, dep := range deps {
+				dependents[dep] = append(dependents[dep], i)
+				inDegrees[i]++
+			}
+		}
+	}
+
+	sorted := make([]Spec, 0, len(specs))
+	done := make([]bool, len(specs))
+	for len(sorted) < len(specs) {
+		next := -1
+		for i, spec := range specs {
+			if done[i] || inDegrees[i] != 0 {
+				continue
+			}
+			if next == -1 || constructors[spec.Kind()].Priority < constructors[specs[next].Kind()].Priority {
+				next = i
+			}
+		}
+
+		if next == -1 {
+			var names []string
+			for i, spec := range specs {
+				if !done[i] {
+					names = append(names, spec.Name())
+				}
+			}
+			return nil, fmt.Errorf("plugins %s have cyclic dependencies", strings.Join(names, ", "))
+		}
+
+		done[next] = true
+		sorted = append(sorted, specs[next])
+		for _, dependent := range dependents[next] {
+			inDegrees[dependent]--
+		}
+	}
+
+	return sorted, nil
+}
+
 // ConstructorsByKind is a slice of Constructor, which is sortable by Kind.
 type ConstructorsByKind []*Constructor
 
@@ -0,0 +1,115 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugins
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSpec struct {
+	BaseSpec `json:",inline"`
+}
+
+func (s testSpec) Validate() error { return nil }
+
+type testPlugin struct {
+	Spec
+}
+
+func (p *testPlugin) Close() error { return nil }
+
+func init() {
+	for _, cons := range []*Constructor{
+		{Kind: "TestA"},
+		{Kind: "TestB", DependsOn: []string{"TestA"}},
+		{Kind: "TestC", Priority: -1},
+		{Kind: "TestD", Priority: 1},
+		{Kind: "TestCycleA", DependsOn: []string{"TestCycleB"}},
+		{Kind: "TestCycleB", DependsOn: []string{"TestCycleA"}},
+		{Kind: "TestMissing", DependsOn: []string{"TestNotLoaded"}},
+		{
+			Kind: "TestJSON",
+			DefaultSpec: func() Spec {
+				return envSpec{BaseSpec: BaseSpec{KindField: "TestJSON", NameField: "json"}, Rate: 1, Service: "default"}
+			},
+			NewInstance: func(spec Spec) (Plugin, error) { return &testPlugin{spec}, nil },
+		},
+	} {
+		Register(cons)
+	}
+}
+
+func newTestSpec(kind, name string) Spec {
+	return testSpec{BaseSpec: BaseSpec{KindField: kind, NameField: name}}
+}
+
+func names(specs []Spec) []string {
+	var result []string
+	for _, spec := range specs {
+		result = append(result, spec.Name())
+	}
+	return result
+}
+
+func TestSortSpecs(t *testing.T) {
+	specs, err := SortSpecs([]Spec{
+		newTestSpec("TestD", "d"),
+		newTestSpec("TestB", "b1"),
+		newTestSpec("TestA", "a1"),
+		newTestSpec("TestC", "c"),
+		newTestSpec("TestA", "a2"),
+		newTestSpec("TestB", "b2"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c", "a1", "a2", "b1", "b2", "d"}, names(specs))
+}
+
+func TestSortSpecsErrors(t *testing.T) {
+	_, err := SortSpecs([]Spec{newTestSpec("TestB", "b")})
+	assert.EqualError(t, err, "plugin b depends on kind TestA which is not loaded")
+
+	_, err = SortSpecs([]Spec{newTestSpec("TestMissing", "missing")})
+	assert.EqualError(t, err, "plugin missing depends on kind TestNotLoaded which is not loaded")
+
+	_, err = SortSpecs([]Spec{
+		newTestSpec("TestA", "a"),
+		newTestSpec("TestCycleA", "cycle-a"),
+		newTestSpec("TestCycleB", "cycle-b"),
+	})
+	assert.EqualError(t, err, "plugins cycle-a, cycle-b have cyclic dependencies")
+
+	_, err = SortSpecs([]Spec{newTestSpec("TestNotFound", "none")})
+	assert.EqualError(t, err, "plugin kind TestNotFound not found")
+}
+
+func TestNewSpecFromJSON(t *testing.T) {
+	spec, err := NewSpecFromJSON([]byte(`{"kind":"TestJSON","name":"json-b","serviceName":"b"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, envSpec{BaseSpec: BaseSpec{KindField: "TestJSON", NameField: "json-b"}, Rate: 1, Service: "b"}, spec)
+
+	plug, err := NewFromJSON([]byte(`{"kind":"TestJSON","name":"json-c"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "json-c", plug.Name())
+
+	_, err = NewSpecFromJSON([]byte(`{"kind":"TestNotFound"}`))
+	assert.EqualError(t, err, "plugin kind TestNotFound not found")
+
+	_, err = NewSpecFromJSON([]byte(`{"kind":"TestJSON","tracing.sample.rate":"high"}`))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,174 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resilience
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	stateClosed circuitState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+type (
+	circuitState int
+
+	// transition is the state change of circuit breaker.
+	transition struct {
+		from, to circuitState
+	}
+
+	// circuitBreaker is the count based circuit breaker of a host.
+	circuitBreaker struct {
+		windowSize    int
+		minCalls      int
+		threshold     float64
+		openDuration  time.Duration
+		halfOpenCalls int
+		now           func() time.Time
+
+		mutex    sync.Mutex
+		state    circuitState
+		openedAt time.Time
+
+		// window is the ring of the results of recent calls in closed state,
+		// true means failure.
+		window   []bool
+		next     int
+		failures int
+
+		// permitted, calls and halfFailures count the calls in half open state.
+		permitted    int
+		calls        int
+		halfFailures int
+	}
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case stateClosed:
+		return "CLOSED"
+	case stateOpen:
+		return "OPEN"
+	case stateHalfOpen:
+		return "HALF_OPEN"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func newCircuitBreaker(spec Spec) *circuitBreaker {
+	return &circuitBreaker{
+		windowSize:    spec.SlidingWindowSize,
+		minCalls:      spec.MinimumNumberOfCalls,
+		threshold:     spec.FailureRateThreshold,
+		openDuration:  duration(spec.WaitDurationInOpenState),
+		halfOpenCalls: spec.PermittedNumberOfCallsInHalfOpenState,
+		now:           time.Now,
+		window:        make([]bool, 0, spec.SlidingWindowSize),
+	}
+}
+
+// allow returns whether the call is permitted, and the state change if any.
+func (cb *circuitBreaker) allow() (bool, *transition) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	var t *transition
+	if cb.state == stateOpen && cb.now().Sub(cb.openedAt) >= cb.openDuration {
+		t = cb.transit(stateHalfOpen)
+	}
+
+	switch cb.state {
+	case stateOpen:
+		return false, t
+	case stateHalfOpen:
+		if cb.permitted >= cb.halfOpenCalls {
+			return false, t
+		}
+		cb.permitted++
+		return true, t
+	default:
+		return true, t
+	}
+}
+
+// record records the result of the permitted call, and returns the state change if any.
+func (cb *circuitBreaker) record(failed bool) *transition {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch cb.state {
+	case stateClosed:
+		if len(cb.window) < cb.windowSize {
+			cb.window = append(cb.window, failed)
+		} else {
+			if cb.window[cb.next] {
+				cb.failures--
+			}
+			cb.window[cb.next] = failed
+			cb.next = (cb.next + 1) % cb.windowSize
+		}
+		if failed {
+			cb.failures++
+		}
+
+		if len(cb.window) >= cb.minCalls && rate(cb.failures, len(cb.window)) >= cb.threshold {
+			return cb.transit(stateOpen)
+		}
+	case stateHalfOpen:
+		cb.calls++
+		if failed {
+			cb.halfFailures++
+		}
+
+		if cb.calls < cb.halfOpenCalls {
+			return nil
+		}
+		if rate(cb.halfFailures, cb.calls) >= cb.threshold {
+			return cb.transit(stateOpen)
+		}
+		return cb.transit(stateClosed)
+	}
+
+	// NOTE: The results of the calls permitted before opening are ignored.
+	return nil
+}
+
+// transit changes the state and resets the counters. The caller must hold the mutex.
+func (cb *circuitBreaker) transit(to circuitState) *transition {
+	t := &transition{from: cb.state, to: to}
+
+	cb.state = to
+	switch to {
+	case stateOpen:
+		cb.openedAt = cb.now()
+	case stateClosed:
+		cb.window = cb.window[:0]
+		cb.next, cb.failures = 0, 0
+	}
+	cb.permitted, cb.calls, cb.halfFailures = 0, 0, 0
+
+	return t
+}
+
+func rate(failures, calls int) float64 {
+	return float64(failures) * 100 / float64(calls)
+}
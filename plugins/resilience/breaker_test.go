@@ -0,0 +1,71 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resilience
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	spec := DefaultSpec().(Spec)
+	spec.SlidingWindowSize = 4
+	spec.MinimumNumberOfCalls = 4
+	spec.FailureRateThreshold = 50
+	spec.WaitDurationInOpenState = "10s"
+	spec.PermittedNumberOfCallsInHalfOpenState = 2
+
+	now := time.Now()
+	cb := newCircuitBreaker(spec)
+	cb.now = func() time.Time { return now }
+
+	// The failure rate is calculated after the min calls.
+	assert.Nil(t, cb.record(true))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, cb.record(false))
+	}
+	// The oldest failure slides out of the window.
+	assert.Nil(t, cb.record(false))
+	assert.Nil(t, cb.record(true))
+	assert.Equal(t, &transition{from: stateClosed, to: stateOpen}, cb.record(true))
+
+	allowed, tr := cb.allow()
+	assert.False(t, allowed)
+	assert.Nil(t, tr)
+
+	now = now.Add(10 * time.Second)
+	allowed, tr = cb.allow()
+	assert.True(t, allowed)
+	assert.Equal(t, &transition{from: stateOpen, to: stateHalfOpen}, tr)
+	allowed, _ = cb.allow()
+	assert.True(t, allowed)
+	allowed, _ = cb.allow()
+	assert.False(t, allowed, "only the permitted calls are allowed in half open state")
+
+	assert.Nil(t, cb.record(false))
+	assert.Equal(t, &transition{from: stateHalfOpen, to: stateOpen}, cb.record(true))
+
+	now = now.Add(10 * time.Second)
+	cb.allow()
+	cb.allow()
+	assert.Nil(t, cb.record(false))
+	assert.Equal(t, &transition{from: stateHalfOpen, to: stateClosed}, cb.record(false))
+	assert.Equal(t, 0, len(cb.window))
+	assert.Equal(t, "HALF_OPEN", stateHalfOpen.String())
+}
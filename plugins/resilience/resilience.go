@@ -0,0 +1,305 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package resilience provides retries, timeouts and circuit breakers for the user's clients.
+package resilience
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+	"github.com/openzipkin/zipkin-go"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// maxBackoffShift caps the doublings of the exponential backoff, so it never overflows.
+	maxBackoffShift = 16
+	// maxWaitDuration is the max wait of the exponential backoff unless waitDuration is longer.
+	maxWaitDuration = time.Minute
+	// maxBreakers is the max count of the circuit breakers of hosts,
+	// the least recently used one is evicted if exceeded.
+	maxBreakers = 1024
+)
+
+// ErrCircuitBreakerOpen is the error of the requests rejected by the open circuit breaker.
+var ErrCircuitBreakerOpen = errors.New("circuit breaker is open")
+
+func init() {
+	cons := &plugins.Constructor{
+		Kind:         Kind,
+		DefaultSpec:  DefaultSpec,
+		SystemPlugin: false,
+		NewInstance:  New,
+	}
+
+	plugins.Register(cons)
+}
+
+type (
+	// Resilience is the plugin wrapping the user's clients with retries,
+	// per-attempt timeouts and per-host circuit breakers.
+	// The retries and the state changes of circuit breakers are annotated
+	// to the span in the request context if Zipkin is loaded, which is the span
+	// of the caller such as the server span, because the client span is kept
+	// inside the transport of zipkin-go. So the annotations carry the host.
+	Resilience struct {
+		spec Spec
+
+		timeout      time.Duration
+		waitDuration time.Duration
+
+		mutex    sync.Mutex
+		breakers map[string]*list.Element
+		// lru are the hosts of breakers from the most recently used.
+		lru *list.List // type: *hostBreaker
+	}
+
+	hostBreaker struct {
+		host    string
+		breaker *circuitBreaker
+	}
+
+	// roundTripFunc sends one attempt of the request.
+	roundTripFunc func(req *http.Request) (*http.Response, error)
+
+	// transport applies the resilience to a *http.Client.
+	transport struct {
+		resilience *Resilience
+		base       http.RoundTripper
+	}
+
+	// clientWrapper applies the resilience to a plugins.HTTPDoer.
+	clientWrapper struct {
+		resilience *Resilience
+		httpDoer   plugins.HTTPDoer
+	}
+
+	// cancelBody cancels the context of the attempt after the body is closed.
+	cancelBody struct {
+		io.ReadCloser
+		cancel context.CancelFunc
+	}
+)
+
+// New creates a Resilience plugin.
+func New(pluginSpec plugins.Spec) (plugins.Plugin, error) {
+	spec := pluginSpec.(Spec)
+
+	r := &Resilience{
+		spec:         spec,
+		timeout:      duration(spec.Timeout),
+		waitDuration: duration(spec.WaitDuration),
+		breakers:     map[string]*list.Element{},
+		lru:          list.New(),
+	}
+
+	return r, nil
+}
+
+// Name gets the Resilience name.
+func (r *Resilience) Name() string {
+	return r.spec.Name()
+}
+
+// Close closes the Resilience plugin.
+func (r *Resilience) Close() error {
+	return nil
+}
+
+// WrapUserClient wraps the user's client with the resilience.
+// The *http.Client is wrapped in its transport to stay a *http.Client for other plugins.
+func (r *Resilience) WrapUserClient(c plugins.HTTPDoer) plugins.HTTPDoer {
+	if original, ok := c.(*http.Client); ok {
+		client := *original
+		client.Transport = &transport{resilience: r, base: original.Transport}
+		return &client
+	}
+
+	return &clientWrapper{resilience: r, httpDoer: c}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return t.resilience.do(req, base.RoundTrip)
+}
+
+// Do implements plugins.HTTPDoer.
+func (c *clientWrapper) Do(req *http.Request) (*http.Response, error) {
+	return c.resilience.do(req, c.httpDoer.Do)
+}
+
+// Close implements io.Closer.
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// do sends the request with retries, the request is retried on errors and
+// failure codes if its body could be sent again.
+func (r *Resilience) do(req *http.Request, roundTrip roundTripFunc) (*http.Response, error) {
+	ctx := req.Context()
+	host := req.URL.Host
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			wait := r.backoff(attempt)
+			annotate(ctx, "resilience.retry host=%s attempt=%d wait=%s", host, attempt, wait)
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, fmt.Errorf("get body for retry failed: %v", err)
+				}
+				req = req.Clone(ctx)
+				req.Body = body
+			}
+		}
+
+		breaker := r.breaker(host)
+		if breaker != nil {
+			allowed, t := breaker.allow()
+			r.record(ctx, host, t)
+			if !allowed {
+				annotate(ctx, "resilience.circuitBreaker.rejected host=%s", host)
+				return nil, fmt.Errorf("%w: %s", ErrCircuitBreakerOpen, host)
+			}
+		}
+
+		resp, err := r.attempt(req, roundTrip)
+		failed := err != nil || slices.Contains(r.spec.FailureCodes, resp.StatusCode)
+		if breaker != nil {
+			r.record(ctx, host, breaker.record(failed))
+		}
+
+		if !failed || attempt >= r.spec.MaxAttempts || !replayable || ctx.Err() != nil {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+	}
+}
+
+// attempt sends one attempt with the timeout.
+func (r *Resilience) attempt(req *http.Request, roundTrip roundTripFunc) (*http.Response, error) {
+	if r.timeout <= 0 {
+		return roundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), r.timeout)
+	resp, err := roundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, nil
+}
+
+// backoff returns the duration waited before the attempt.
+func (r *Resilience) backoff(attempt int) time.Duration {
+	switch r.spec.BackOffPolicy {
+	case BackOffExponential:
+		shift := attempt - 2
+		if shift > maxBackoffShift {
+			shift = maxBackoffShift
+		}
+
+		limit := maxWaitDuration
+		if r.waitDuration > limit {
+			limit = r.waitDuration
+		}
+
+		wait := r.waitDuration << shift
+		if wait < r.waitDuration || wait > limit {
+			wait = limit
+		}
+
+		return wait
+	default:
+		return time.Duration(float64(r.waitDuration) * (0.5 + rand.Float64()))
+	}
+}
+
+// breaker returns the circuit breaker of the host, it returns nil if circuit breakers are disabled.
+// The breakers are bounded by maxBreakers, so the clients of many hosts don't exhaust the memory.
+func (r *Resilience) breaker(host string) *circuitBreaker {
+	if r.spec.SlidingWindowSize <= 0 {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if elem, exists := r.breakers[host]; exists {
+		r.lru.MoveToFront(elem)
+		return elem.Value.(*hostBreaker).breaker
+	}
+
+	if r.lru.Len() >= maxBreakers {
+		oldest := r.lru.Remove(r.lru.Back()).(*hostBreaker)
+		delete(r.breakers, oldest.host)
+	}
+
+	breaker := newCircuitBreaker(r.spec)
+	r.breakers[host] = r.lru.PushFront(&hostBreaker{host: host, breaker: breaker})
+
+	return breaker
+}
+
+// record logs and annotates the state change of circuit breaker.
+func (r *Resilience) record(ctx context.Context, host string, t *transition) {
+	if t == nil {
+		return
+	}
+
+	log.Printf("circuit breaker of %s changed from %s to %s", host, t.from, t.to)
+	annotate(ctx, "resilience.circuitBreaker host=%s %s->%s", host, t.from, t.to)
+}
+
+// annotate annotates the span in ctx if any, which is the span of the caller.
+func annotate(ctx context.Context, format string, args ...interface{}) {
+	if span := zipkin.SpanFromContext(ctx); span != nil {
+		span.Annotate(time.Now(), fmt.Sprintf(format, args...))
+	}
+}
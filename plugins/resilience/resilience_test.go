@@ -0,0 +1,289 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resilience
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/reporter/recorder"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+)
+
+func newTestResilience(t *testing.T, update func(spec *Spec)) *Resilience {
+	spec := DefaultSpec().(Spec)
+	spec.WaitDuration = "1ms"
+	if update != nil {
+		update(&spec)
+	}
+	assert.Nil(t, spec.Validate())
+
+	plug, err := plugins.New(spec)
+	assert.Nil(t, err)
+
+	return plug.(*Resilience)
+}
+
+// newFailingServer returns the server failing with the status code for the first failures requests.
+func newFailingServer(failures int32, code int) (*httptest.Server, *int32) {
+	calls := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(calls, 1) <= failures {
+			w.WriteHeader(code)
+		}
+		w.Write(body)
+	}))
+
+	return server, calls
+}
+
+// newTracingContext returns the context with a span, and the function finishing it.
+func newTracingContext(t *testing.T) (context.Context, func() model.SpanModel) {
+	rep := recorder.NewReporter()
+	tracer, err := zipkin.NewTracer(rep)
+	assert.Nil(t, err)
+
+	span := tracer.StartSpan("server")
+	return zipkin.NewContext(context.Background(), span), func() model.SpanModel {
+		span.Finish()
+		spans := rep.Flush()
+		assert.Equal(t, 1, len(spans))
+		return spans[0]
+	}
+}
+
+func newGetRequest(t *testing.T, ctx context.Context, url string) *http.Request {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	assert.Nil(t, err)
+	return req
+}
+
+func annotations(span model.SpanModel) []string {
+	values := []string{}
+	for _, annotation := range span.Annotations {
+		values = append(values, annotation.Value)
+	}
+	return values
+}
+
+func TestRetry(t *testing.T) {
+	server, calls := newFailingServer(2, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	client := newTestResilience(t, nil).WrapUserClient(server.Client())
+	_, ok := client.(*http.Client)
+	assert.True(t, ok, "*http.Client must stay a *http.Client for other plugins")
+
+	ctx, finish := newTracingContext(t)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, bytes.NewReader([]byte("order")))
+	assert.Nil(t, err)
+
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "order", string(body), "the body is sent again in retries")
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+
+	values := annotations(finish())
+	assert.Equal(t, 2, len(values))
+	assert.True(t, strings.HasPrefix(values[0], "resilience.retry host="+req.URL.Host+" attempt=2"))
+	assert.True(t, strings.HasPrefix(values[1], "resilience.retry host="+req.URL.Host+" attempt=3"))
+}
+
+func TestRetryExhausted(t *testing.T) {
+	server, calls := newFailingServer(10, http.StatusBadGateway)
+	defer server.Close()
+
+	client := newTestResilience(t, func(spec *Spec) {
+		spec.BackOffPolicy = BackOffExponential
+	}).WrapUserClient(server.Client())
+
+	resp, err := client.Do(newGetRequest(t, context.Background(), server.URL))
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+
+	// The codes not in failure codes are not retried.
+	server, calls = newFailingServer(10, http.StatusNotFound)
+	defer server.Close()
+	resp, err = client.Do(newGetRequest(t, context.Background(), server.URL))
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestBackoff(t *testing.T) {
+	spec := DefaultSpec().(Spec)
+	spec.WaitDuration = "500ms"
+	spec.BackOffPolicy = BackOffExponential
+	plug, err := New(spec)
+	assert.Nil(t, err)
+	r := plug.(*Resilience)
+
+	assert.Equal(t, 500*time.Millisecond, r.backoff(2))
+	assert.Equal(t, time.Second, r.backoff(3))
+	assert.Equal(t, 32*time.Second, r.backoff(8))
+
+	// The exponential backoff is clamped and never overflows.
+	assert.Equal(t, maxWaitDuration, r.backoff(9))
+	assert.Equal(t, maxWaitDuration, r.backoff(100))
+	assert.Equal(t, maxWaitDuration, r.backoff(1<<20))
+
+	r.waitDuration = 2 * time.Hour
+	assert.Equal(t, 2*time.Hour, r.backoff(2))
+	assert.Equal(t, 2*time.Hour, r.backoff(70))
+}
+
+func TestNotReplayable(t *testing.T) {
+	server, calls := newFailingServer(10, http.StatusInternalServerError)
+	defer server.Close()
+
+	r := newTestResilience(t, nil)
+	doer := r.WrapUserClient(plugins.HTTPDoer(&struct{ *http.Client }{server.Client()}))
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, ioutil.NopCloser(strings.NewReader("order")))
+	assert.Nil(t, err)
+	resp, err := doer.Do(req)
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestTimeout(t *testing.T) {
+	calls := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) == 1 {
+			time.Sleep(500 * time.Millisecond)
+		}
+		w.Write([]byte("delivered"))
+	}))
+	defer server.Close()
+
+	client := newTestResilience(t, func(spec *Spec) {
+		spec.Timeout = "100ms"
+	}).WrapUserClient(server.Client())
+
+	resp, err := client.Do(newGetRequest(t, context.Background(), server.URL))
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	// The body is still readable after the attempt returned.
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "delivered", string(body))
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestCircuitBreakerOpen(t *testing.T) {
+	server, calls := newFailingServer(100, http.StatusInternalServerError)
+	defer server.Close()
+
+	client := newTestResilience(t, func(spec *Spec) {
+		spec.MaxAttempts = 1
+		spec.SlidingWindowSize = 4
+		spec.MinimumNumberOfCalls = 4
+	}).WrapUserClient(server.Client())
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Do(newGetRequest(t, context.Background(), server.URL))
+		assert.Nil(t, err)
+		resp.Body.Close()
+	}
+
+	ctx, finish := newTracingContext(t)
+	resp, err := client.Do(newGetRequest(t, ctx, server.URL))
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	_, err = client.Do(newGetRequest(t, ctx, server.URL))
+	assert.True(t, errors.Is(err, ErrCircuitBreakerOpen), "%v", err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(calls))
+
+	values := annotations(finish())
+	assert.Equal(t, 2, len(values))
+	assert.Contains(t, values[0], "CLOSED->OPEN")
+	assert.Contains(t, values[1], "resilience.circuitBreaker.rejected")
+}
+
+func TestBreakersBounded(t *testing.T) {
+	plug, err := New(DefaultSpec())
+	assert.Nil(t, err)
+	r := plug.(*Resilience)
+
+	first := r.breaker("host-0")
+	for i := 1; i < maxBreakers; i++ {
+		r.breaker(fmt.Sprintf("host-%d", i))
+	}
+	assert.Same(t, first, r.breaker("host-0"))
+
+	// The least recently used host-1 is evicted.
+	r.breaker("new-host")
+	assert.Len(t, r.breakers, maxBreakers)
+	assert.Equal(t, maxBreakers, r.lru.Len())
+	assert.NotContains(t, r.breakers, "host-1")
+	assert.Same(t, first, r.breaker("host-0"))
+}
+
+func TestValidate(t *testing.T) {
+	spec := DefaultSpec().(Spec)
+	assert.Nil(t, spec.Validate())
+
+	spec.FailureCodes = []int{5000}
+	spec.MaxAttempts = 0
+	spec.Timeout = "soon"
+	spec.BackOffPolicy = "linear"
+
+	err := spec.Validate()
+	assert.NotNil(t, err)
+	for _, msg := range []string{"resilience.failureCodes", "resilience.retry.maxAttempts", "resilience.timeLimiter.timeout", "resilience.retry.backOffPolicy"} {
+		assert.Contains(t, err.Error(), msg)
+	}
+}
+
+func TestSpecSchema(t *testing.T) {
+	schema := plugins.SpecSchema(DefaultSpec())
+	codes := schema.Properties["resilience.failureCodes"]
+	if assert.NotNil(t, codes) {
+		assert.Equal(t, "array", codes.Type)
+		assert.Equal(t, "integer", codes.Items.Type)
+		assert.Equal(t, DefaultSpec().(Spec).FailureCodes, codes.Default)
+	}
+	assert.Equal(t, []string{Kind}, schema.Properties["kind"].Enum)
+}
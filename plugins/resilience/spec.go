@@ -0,0 +1,122 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resilience
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/megaease/easeagent-sdk-go/plugins"
+)
+
+const (
+	// Kind is the kind of Resilience plugin.
+	Kind = "Resilience"
+	// Name is the name of Resilience plugin.
+	Name = "Resilience"
+
+	// BackOffRandom waits a random duration in [0.5, 1.5) times of waitDuration.
+	BackOffRandom = "random"
+	// BackOffExponential doubles waitDuration after every retry.
+	BackOffExponential = "exponential"
+)
+
+type (
+	// Spec is the Resilience spec, the keys follow the resilience of EaseMesh.
+	Spec struct {
+		plugins.BaseSpec `json:",inline"`
+
+		FailureCodes []int  `json:"resilience.failureCodes" jsonschema_description:"the response status codes regarded as failures"`
+		Timeout      string `json:"resilience.timeLimiter.timeout" jsonschema_description:"the timeout of every attempt, such as 100ms, empty value means no timeout"`
+
+		MaxAttempts   int    `json:"resilience.retry.maxAttempts" jsonschema:"minimum=1" jsonschema_description:"the max attempts of a request including the first one, 1 means no retry"`
+		WaitDuration  string `json:"resilience.retry.waitDuration" jsonschema_description:"the base duration waited before retrying, such as 500ms"`
+		BackOffPolicy string `json:"resilience.retry.backOffPolicy" jsonschema:"enum=random,enum=exponential" jsonschema_description:"the backoff policy of retries"`
+
+		SlidingWindowSize                     int     `json:"resilience.circuitBreaker.slidingWindowSize" jsonschema:"minimum=0" jsonschema_description:"the count of recent calls of a host to calculate the failure rate, 0 disables circuit breakers"`
+		MinimumNumberOfCalls                  int     `json:"resilience.circuitBreaker.minimumNumberOfCalls" jsonschema:"minimum=1" jsonschema_description:"the min count of calls before calculating the failure rate"`
+		FailureRateThreshold                  float64 `json:"resilience.circuitBreaker.failureRateThreshold" jsonschema:"minimum=1,maximum=100" jsonschema_description:"the failure rate in percentage to open the circuit breaker"`
+		WaitDurationInOpenState               string  `json:"resilience.circuitBreaker.waitDurationInOpenState" jsonschema_description:"the duration of the open state before half open, such as 60s"`
+		PermittedNumberOfCallsInHalfOpenState int     `json:"resilience.circuitBreaker.permittedNumberOfCallsInHalfOpenState" jsonschema:"minimum=1" jsonschema_description:"the count of calls permitted in the half open state"`
+	}
+)
+
+// DefaultSpec returns the default spec of Resilience.
+func DefaultSpec() plugins.Spec {
+	return Spec{
+		BaseSpec: plugins.BaseSpec{
+			KindField: Kind,
+			NameField: Name,
+		},
+		FailureCodes: []int{500, 502, 503, 504},
+
+		MaxAttempts:   3,
+		WaitDuration:  "500ms",
+		BackOffPolicy: BackOffRandom,
+
+		SlidingWindowSize:                     100,
+		MinimumNumberOfCalls:                  10,
+		FailureRateThreshold:                  50,
+		WaitDurationInOpenState:               "60s",
+		PermittedNumberOfCallsInHalfOpenState: 10,
+	}
+}
+
+// Validate validates the Resilience spec, it reports all problems together.
+func (spec Spec) Validate() error {
+	var msgs []string
+
+	if err := plugins.ValidateSchema(spec); err != nil {
+		msgs = append(msgs, err.Error())
+	}
+
+	for _, code := range spec.FailureCodes {
+		if code < 100 || code > 599 {
+			msgs = append(msgs, fmt.Sprintf("invalid resilience.failureCodes %d", code))
+		}
+	}
+
+	durations := []struct {
+		key   string
+		value string
+	}{
+		{"resilience.timeLimiter.timeout", spec.Timeout},
+		{"resilience.retry.waitDuration", spec.WaitDuration},
+		{"resilience.circuitBreaker.waitDurationInOpenState", spec.WaitDurationInOpenState},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(d.value); err != nil || duration < 0 {
+			msgs = append(msgs, fmt.Sprintf("invalid %s %q: want duration such as 100ms", d.key, d.value))
+		}
+	}
+
+	if len(msgs) != 0 {
+		return fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+
+	return nil
+}
+
+// duration parses the validated duration, empty value means zero.
+func duration(value string) time.Duration {
+	d, _ := time.ParseDuration(value)
+	return d
+}
@@ -0,0 +1,261 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugins
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// SchemaDraft is the JSON Schema draft of generated schemas.
+const SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+type (
+	// Schema is a JSON Schema, it only covers the keywords used by specs.
+	//
+	// The schemas of spec fields are generated from the struct tags, for example:
+	//
+	//	SampleRate float64 `json:"tracing.sample.rate" jsonschema:"minimum=0,maximum=1" jsonschema_description:"the tracing sample rate"`
+	//
+	// The jsonschema tag supports required, minimum=<number>, maximum=<number>
+	// and enum=<value> which could be repeated.
+	Schema struct {
+		Schema               string             `json:"$schema,omitempty"`
+		Title                string             `json:"title,omitempty"`
+		Description          string             `json:"description,omitempty"`
+		Type                 string             `json:"type,omitempty"`
+		Default              interface{}        `json:"default,omitempty"`
+		Minimum              *float64           `json:"minimum,omitempty"`
+		Maximum              *float64           `json:"maximum,omitempty"`
+		Enum                 []string           `json:"enum,omitempty"`
+		Items                *Schema            `json:"items,omitempty"`
+		Properties           map[string]*Schema `json:"properties,omitempty"`
+		AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+		Required             []string           `json:"required,omitempty"`
+	}
+
+	// fieldRule is the rule of the jsonschema tag.
+	fieldRule struct {
+		required bool
+		minimum  *float64
+		maximum  *float64
+		enum     []string
+	}
+)
+
+// SpecSchema returns the schema of the spec, the defaults are the field values of the spec.
+// It covers all fields marshaled by json, and the kind and name of plugin specs.
+func SpecSchema(spec interface{}) *Schema {
+	schema := &Schema{
+		Type:                 "object",
+		Properties:           map[string]*Schema{},
+		AdditionalProperties: false,
+	}
+
+	v := reflect.ValueOf(spec)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	if pluginSpec, ok := spec.(Spec); ok {
+		schema.Properties["kind"] = &Schema{Type: "string", Description: "the kind of plugin"}
+		schema.Properties["name"] = &Schema{Type: "string", Description: "the unique name of plugin"}
+		if pluginSpec.Kind() != "" {
+			schema.Properties["kind"].Enum = []string{pluginSpec.Kind()}
+		}
+		if pluginSpec.Name() != "" {
+			schema.Properties["name"].Default = pluginSpec.Name()
+		}
+	}
+
+	for _, f := range jsonFieldsOf(v) {
+		rule, err := parseRule(f.tag.Get("jsonschema"))
+		if err != nil {
+			// NOTE: The invalid rules are reported by ValidateSchema.
+			rule = &fieldRule{}
+		}
+
+		fieldSchema := typeSchema(f.value.Type())
+		if description := f.tag.Get("jsonschema_description"); description != "" {
+			fieldSchema.Description = description
+		}
+		if rule.minimum != nil {
+			fieldSchema.Minimum = rule.minimum
+		}
+		fieldSchema.Maximum = rule.maximum
+		fieldSchema.Enum = rule.enum
+		if !f.value.IsZero() || f.value.Kind() == reflect.Bool {
+			fieldSchema.Default = f.value.Interface()
+		}
+
+		schema.Properties[f.key] = fieldSchema
+		if rule.required {
+			schema.Required = append(schema.Required, f.key)
+		}
+	}
+	sort.Strings(schema.Required)
+
+	return schema
+}
+
+// KindSchemas returns the schemas of the default specs of all registered plugins keyed by kind.
+func KindSchemas() map[string]*Schema {
+	schemas := map[string]*Schema{}
+	for kind, cons := range constructors {
+		schema := SpecSchema(cons.DefaultSpec())
+		schema.Title = kind
+		schemas[kind] = schema
+	}
+
+	return schemas
+}
+
+// ValidateSchema validates the values of the spec against the rules of
+// the jsonschema tags, please see Schema. It reports all problems together.
+func ValidateSchema(spec interface{}) error {
+	v := reflect.ValueOf(spec)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	var msgs []string
+	for _, f := range jsonFieldsOf(v) {
+		rule, err := parseRule(f.tag.Get("jsonschema"))
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("invalid jsonschema tag of %s: %v", f.key, err))
+			continue
+		}
+
+		if msg := rule.check(f.key, f.value); msg != "" {
+			msgs = append(msgs, msg)
+		}
+	}
+
+	if len(msgs) != 0 {
+		return fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+
+	return nil
+}
+
+func parseRule(tag string) (*fieldRule, error) {
+	rule := &fieldRule{}
+	for _, item := range strings.Split(tag, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		switch kv[0] {
+		case "":
+		case "required":
+			rule.required = true
+		case "minimum", "maximum":
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("%s without value", kv[0])
+			}
+			f, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %s", kv[0], kv[1])
+			}
+			if kv[0] == "minimum" {
+				rule.minimum = &f
+			} else {
+				rule.maximum = &f
+			}
+		case "enum":
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("enum without value")
+			}
+			rule.enum = append(rule.enum, kv[1])
+		default:
+			return nil, fmt.Errorf("unknown rule %s", kv[0])
+		}
+	}
+
+	return rule, nil
+}
+
+// check returns the message of the value violating the rule, the empty value
+// of enum is allowed, which means the default one.
+func (r *fieldRule) check(key string, v reflect.Value) string {
+	var n float64
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.String:
+		if len(r.enum) != 0 && v.String() != "" && !slices.Contains(r.enum, v.String()) {
+			return fmt.Sprintf("%s %q is not one of %s", key, v.String(), strings.Join(r.enum, ", "))
+		}
+		return ""
+	default:
+		return ""
+	}
+
+	switch {
+	case r.minimum != nil && r.maximum != nil && (n < *r.minimum || n > *r.maximum):
+		return fmt.Sprintf("%s %v is out of range [%v, %v]", key, n, *r.minimum, *r.maximum)
+	case r.minimum != nil && n < *r.minimum:
+		return fmt.Sprintf("%s %v is less than %v", key, n, *r.minimum)
+	case r.maximum != nil && n > *r.maximum:
+		return fmt.Sprintf("%s %v is greater than %v", key, n, *r.maximum)
+	default:
+		return ""
+	}
+}
+
+func typeSchema(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t == reflect.TypeOf(time.Duration(0)) {
+			return &Schema{Type: "integer", Description: "nanoseconds"}
+		}
+		return &Schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: new(float64)}
+	case reflect.Slice:
+		return &Schema{Type: "array", Items: typeSchema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: typeSchema(t.Elem())}
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Struct:
+		// NOTE: The rules and defaults of nested fields are not generated.
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+		for _, f := range jsonFieldsOf(reflect.New(t).Elem()) {
+			fieldSchema := typeSchema(f.value.Type())
+			fieldSchema.Description = f.tag.Get("jsonschema_description")
+			schema.Properties[f.key] = fieldSchema
+		}
+		return schema
+	default:
+		// NOTE: The interfaces could be any values.
+		return &Schema{}
+	}
+}
@@ -0,0 +1,91 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugins
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type schemaSpec struct {
+	BaseSpec `json:",inline"`
+
+	Rate    float64           `json:"rate" jsonschema:"required,minimum=0,maximum=1" jsonschema_description:"the rate"`
+	Port    uint16            `json:"port" jsonschema:"maximum=1024"`
+	Mode    string            `json:"mode" jsonschema:"enum=fast,enum=slow"`
+	Enable  bool              `json:"enable"`
+	Headers []string          `json:"headers"`
+	Tags    map[string]string `json:"tags"`
+	Codes   []int             `json:"codes"`
+	Limits  map[string][]int  `json:"limits"`
+	Rules   []schemaRule      `json:"rules"`
+	Ignored string            `json:"-"`
+}
+
+type schemaRule struct {
+	Path string  `json:"path" jsonschema_description:"the path"`
+	Rate float64 `json:"rate"`
+}
+
+func (s schemaSpec) Validate() error { return ValidateSchema(s) }
+
+func TestSpecSchema(t *testing.T) {
+	schema := SpecSchema(schemaSpec{BaseSpec: BaseSpec{KindField: "Schema"}, Rate: 0.5, Mode: "fast"})
+
+	buff, err := json.Marshal(schema)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"rate": {"type": "number", "description": "the rate", "default": 0.5, "minimum": 0, "maximum": 1},
+			"port": {"type": "integer", "minimum": 0, "maximum": 1024},
+			"mode": {"type": "string", "default": "fast", "enum": ["fast", "slow"]},
+			"enable": {"type": "boolean", "default": false},
+			"headers": {"type": "array", "items": {"type": "string"}},
+			"tags": {"type": "object", "additionalProperties": {"type": "string"}},
+			"codes": {"type": "array", "items": {"type": "integer"}},
+			"limits": {"type": "object", "additionalProperties": {"type": "array", "items": {"type": "integer"}}},
+			"rules": {"type": "array", "items": {
+				"type": "object",
+				"properties": {
+					"path": {"type": "string", "description": "the path"},
+					"rate": {"type": "number"}
+				},
+				"additionalProperties": false
+			}},
+			"kind": {"type": "string", "description": "the kind of plugin", "enum": ["Schema"]},
+			"name": {"type": "string", "description": "the unique name of plugin"}
+		},
+		"additionalProperties": false,
+		"required": ["rate"]
+	}`, string(buff))
+}
+
+func TestValidateSchema(t *testing.T) {
+	assert.Nil(t, schemaSpec{Rate: 1, Port: 80}.Validate())
+	assert.Nil(t, schemaSpec{Mode: "slow"}.Validate())
+
+	err := schemaSpec{Rate: 1.5, Port: 8080, Mode: "normal"}.Validate()
+	assert.EqualError(t, err, `rate 1.5 is out of range [0, 1]; port 8080 is greater than 1024; mode "normal" is not one of fast, slow`)
+
+	type badSpec struct {
+		Rate float64 `json:"rate" jsonschema:"minimum=low"`
+	}
+	assert.EqualError(t, ValidateSchema(&badSpec{}), "invalid jsonschema tag of rate: invalid minimum low")
+}
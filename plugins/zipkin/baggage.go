@@ -0,0 +1,366 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zipkin
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/middleware"
+	"github.com/openzipkin/zipkin-go/model"
+)
+
+const (
+	// baggageHeader is the W3C baggage header.
+	baggageHeader = "baggage"
+	// baggageTagPrefix is the prefix of the span tags copied from baggage.
+	baggageTagPrefix = "baggage."
+
+	defaultBaggageMaxEntries = 64
+	defaultBaggageMaxBytes   = 8192
+)
+
+var baggageKeyRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_.\-]*$`)
+
+type (
+	// baggagePolicy is the allowlist and limits of baggage.
+	baggagePolicy struct {
+		keys         map[string]struct{}
+		headerPrefix string
+		maxEntries   int
+		maxBytes     int
+	}
+
+	// baggageFields is the baggage carried by the span context, which is shared
+	// by the child spans. It implements model.BaggageFields for zipkinhttp:
+	// the server middleware adds all request headers, and the client transport
+	// injects the headers it iterates.
+	baggageFields struct {
+		policy *baggagePolicy
+
+		mutex  sync.Mutex
+		keys   []string
+		values map[string]string
+	}
+)
+
+var (
+	_ middleware.BaggageHandler = (*baggagePolicy)(nil)
+	_ model.BaggageFields       = (*baggageFields)(nil)
+)
+
+// newBaggagePolicy returns the baggage policy of spec, it returns nil if baggage is disabled.
+func newBaggagePolicy(spec Spec) *baggagePolicy {
+	if len(spec.BaggageKeys) == 0 {
+		return nil
+	}
+
+	p := &baggagePolicy{
+		keys:         map[string]struct{}{},
+		headerPrefix: strings.ToLower(spec.BaggageHeaderPrefix),
+		maxEntries:   spec.BaggageMaxEntries,
+		maxBytes:     spec.BaggageMaxBytes,
+	}
+	for _, key := range spec.BaggageKeys {
+		p.keys[strings.ToLower(key)] = struct{}{}
+	}
+	if p.maxEntries == 0 {
+		p.maxEntries = defaultBaggageMaxEntries
+	}
+	if p.maxBytes == 0 {
+		p.maxBytes = defaultBaggageMaxBytes
+	}
+
+	return p
+}
+
+// New implements middleware.BaggageHandler.
+func (p *baggagePolicy) New() model.BaggageFields {
+	return &baggageFields{
+		policy: p,
+		values: map[string]string{},
+	}
+}
+
+// Get returns the value of the baggage key.
+func (b *baggageFields) Get(key string) []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	value, exists := b.values[strings.ToLower(key)]
+	if !exists {
+		return nil
+	}
+
+	return []string{value}
+}
+
+// Add adds the baggage from the request header, it returns false if the header is not baggage.
+func (b *baggageFields) Add(header string, values ...string) bool {
+	header = strings.ToLower(header)
+
+	added := false
+	switch {
+	case b.policy.headerPrefix == "" && header == baggageHeader:
+		for _, value := range values {
+			for _, member := range strings.Split(value, ",") {
+				key, value, ok := parseBaggageMember(member)
+				if ok && b.set(key, value) == nil {
+					added = true
+				}
+			}
+		}
+	case b.policy.headerPrefix != "" && strings.HasPrefix(header, b.policy.headerPrefix):
+		if len(values) == 0 {
+			return false
+		}
+		value, err := url.PathUnescape(values[len(values)-1])
+		if err == nil && b.set(strings.TrimPrefix(header, b.policy.headerPrefix), value) == nil {
+			added = true
+		}
+	}
+
+	return added
+}
+
+// Set sets the baggage key, it returns false if the key is not allowed or the limits are exceeded.
+func (b *baggageFields) Set(key string, values ...string) bool {
+	if len(values) == 0 {
+		return false
+	}
+
+	return b.set(key, values[len(values)-1]) == nil
+}
+
+// Delete deletes the baggage key.
+func (b *baggageFields) Delete(key string) bool {
+	key = strings.ToLower(key)
+	if _, allowed := b.policy.keys[key]; !allowed {
+		return false
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, exists := b.values[key]; exists {
+		delete(b.values, key)
+		for i, k := range b.keys {
+			if k == key {
+				b.keys = append(b.keys[:i], b.keys[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return true
+}
+
+// Iterate iterates the headers carrying the baggage, which are injected by the client transport.
+func (b *baggageFields) Iterate(f func(key string, values []string)) {
+	b.mutex.Lock()
+	keys := append([]string{}, b.keys...)
+	values := make(map[string]string, len(b.values))
+	for k, v := range b.values {
+		values[k] = v
+	}
+	b.mutex.Unlock()
+
+	if len(keys) == 0 {
+		return
+	}
+
+	if b.policy.headerPrefix != "" {
+		for _, key := range keys {
+			f(b.policy.headerPrefix+key, []string{url.PathEscape(values[key])})
+		}
+		return
+	}
+
+	members := make([]string, 0, len(keys))
+	for _, key := range keys {
+		members = append(members, key+"="+url.PathEscape(values[key]))
+	}
+	f(baggageHeader, []string{strings.Join(members, ",")})
+}
+
+// all returns the copy of all baggage.
+func (b *baggageFields) all() map[string]string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	values := make(map[string]string, len(b.values))
+	for k, v := range b.values {
+		values[k] = v
+	}
+
+	return values
+}
+
+func (b *baggageFields) set(key, value string) error {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if _, allowed := b.policy.keys[key]; !allowed {
+		return fmt.Errorf("baggage key %s is not allowed", key)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	old, exists := b.values[key]
+	if !exists && len(b.values) >= b.policy.maxEntries {
+		return fmt.Errorf("baggage exceeds max entries %d", b.policy.maxEntries)
+	}
+
+	size := 0
+	for k, v := range b.values {
+		size += len(k) + len(url.PathEscape(v)) + 2
+	}
+	if exists {
+		size -= len(key) + len(url.PathEscape(old)) + 2
+	}
+	if size+len(key)+len(url.PathEscape(value))+2 > b.policy.maxBytes {
+		return fmt.Errorf("baggage exceeds max bytes %d", b.policy.maxBytes)
+	}
+
+	if !exists {
+		b.keys = append(b.keys, key)
+	}
+	b.values[key] = value
+
+	return nil
+}
+
+// parseBaggageMember parses the W3C baggage list member: key=value;properties,
+// the properties are ignored.
+func parseBaggageMember(member string) (string, string, bool) {
+	member = strings.SplitN(member, ";", 2)[0]
+	kv := strings.SplitN(member, "=", 2)
+	if len(kv) != 2 {
+		return "", "", false
+	}
+
+	key := strings.TrimSpace(kv[0])
+	value, err := url.PathUnescape(strings.TrimSpace(kv[1]))
+	if key == "" || err != nil {
+		return "", "", false
+	}
+
+	return key, value, true
+}
+
+// validateBaggage validates the baggage settings of spec.
+func validateBaggage(spec Spec) []string {
+	var msgs []string
+	for _, key := range spec.BaggageKeys {
+		if !baggageKeyRegexp.MatchString(strings.ToLower(key)) {
+			msgs = append(msgs, fmt.Sprintf("invalid tracing.baggage.keys %q: want letters, digits, _, - and .", key))
+		}
+	}
+
+	for _, key := range spec.BaggageTagKeys {
+		if !containsFold(spec.BaggageKeys, key) {
+			msgs = append(msgs, fmt.Sprintf("invalid tracing.baggage.tagKeys %q: not in tracing.baggage.keys", key))
+		}
+	}
+
+	return msgs
+}
+
+func containsFold(ss []string, s string) bool {
+	for _, item := range ss {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// baggageFromContext returns the baggage of the span in ctx, it returns nil if there is none.
+func baggageFromContext(ctx context.Context) *baggageFields {
+	if ctx == nil {
+		return nil
+	}
+
+	fields, _ := zipkin.BaggageFromContext(ctx).(*baggageFields)
+	return fields
+}
+
+// rootSpanOptions returns the options attaching fresh baggage to the root span.
+func (z *Zipkin) rootSpanOptions(options []zipkin.SpanOption) []zipkin.SpanOption {
+	policy := z.load().baggage
+	if policy == nil {
+		return options
+	}
+
+	return append([]zipkin.SpanOption{zipkin.Parent(model.SpanContext{Baggage: policy.New()})}, options...)
+}
+
+// tagBaggage copies the baggage of tag keys onto the span.
+func (z *Zipkin) tagBaggage(span zipkin.Span) {
+	if span == nil {
+		return
+	}
+
+	fields, _ := span.Context().Baggage.(*baggageFields)
+	if fields == nil {
+		return
+	}
+
+	values := fields.all()
+	for _, key := range z.load().spec.BaggageTagKeys {
+		key = strings.ToLower(key)
+		if value, exists := values[key]; exists {
+			span.Tag(baggageTagPrefix+key, value)
+		}
+	}
+}
+
+// SetBaggage sets the baggage carried along the call chain by the span in ctx,
+// it fails if baggage is disabled, the key is not allowed or the limits are exceeded.
+func (z *Zipkin) SetBaggage(ctx context.Context, key, value string) error {
+	fields := baggageFromContext(ctx)
+	if fields == nil {
+		if z.load().baggage == nil {
+			return fmt.Errorf("baggage is disabled, please set tracing.baggage.keys")
+		}
+		return fmt.Errorf("no span carrying baggage in context")
+	}
+
+	err := fields.set(key, value)
+	if err != nil {
+		return err
+	}
+
+	z.tagBaggage(zipkin.SpanFromContext(ctx))
+
+	return nil
+}
+
+// Baggage returns the baggage carried by the span in ctx, the keys are lower case.
+func (z *Zipkin) Baggage(ctx context.Context) map[string]string {
+	fields := baggageFromContext(ctx)
+	if fields == nil {
+		return map[string]string{}
+	}
+
+	return fields.all()
+}
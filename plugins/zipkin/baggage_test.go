@@ -0,0 +1,159 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zipkin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBaggageZipkin(t *testing.T, rep *memReporter, update func(spec *Spec)) *Zipkin {
+	spec := newTestSpec(rep)
+	spec.BaggageKeys = []string{"tenant", "user-id"}
+	if update != nil {
+		update(&spec)
+	}
+	assert.Nil(t, spec.Validate())
+
+	plug, err := New(spec)
+	assert.Nil(t, err)
+
+	return plug.(*Zipkin)
+}
+
+// TestBaggageRoundTrip receives the baggage from the upstream service,
+// sets more baggage and sends all of them to the downstream service.
+func TestBaggageRoundTrip(t *testing.T) {
+	cases := []struct {
+		name     string
+		prefix   string
+		inbound  http.Header
+		outbound map[string]string
+	}{
+		{
+			name:     "w3c",
+			inbound:  http.Header{"Baggage": {"tenant=megaease;prop=1, unknown=dropped"}},
+			outbound: map[string]string{"Baggage": "tenant=megaease,user-id=a%20b"},
+		},
+		{
+			name:     "header prefix",
+			prefix:   "Baggage-",
+			inbound:  http.Header{"Baggage-Tenant": {"megaease"}, "Baggage-Unknown": {"dropped"}},
+			outbound: map[string]string{"Baggage-Tenant": "megaease", "Baggage-User-Id": "a%20b"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var outbound http.Header
+			downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				outbound = r.Header.Clone()
+			}))
+			defer downstream.Close()
+
+			rep := &memReporter{}
+			z := newBaggageZipkin(t, rep, func(spec *Spec) {
+				spec.BaggageHeaderPrefix = c.prefix
+				spec.BaggageTagKeys = []string{"tenant"}
+			})
+			client := z.WrapUserClient(downstream.Client())
+
+			var received map[string]string
+			handler := z.WrapUserHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = z.Baggage(r.Context())
+				assert.Nil(t, z.SetBaggage(r.Context(), "User-Id", "a b"))
+				assert.NotNil(t, z.SetBaggage(r.Context(), "unknown", "value"))
+
+				req, err := http.NewRequest(http.MethodGet, downstream.URL, nil)
+				assert.Nil(t, err)
+				resp, err := client.Do(z.WrapUserClientRequest(r.Context(), req))
+				if assert.Nil(t, err) {
+					resp.Body.Close()
+				}
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header = c.inbound
+			handler(httptest.NewRecorder(), req)
+
+			assert.Equal(t, map[string]string{"tenant": "megaease"}, received)
+			for header, value := range c.outbound {
+				assert.Equal(t, value, outbound.Get(header), header)
+			}
+			assert.NotContains(t, outbound.Get("Baggage"), "unknown")
+			assert.Empty(t, outbound.Get("Baggage-Unknown"))
+
+			// The server span is tagged with the tag keys only.
+			for _, span := range rep.spans {
+				if span.Kind == model.Server {
+					assert.Equal(t, "megaease", span.Tags["baggage.tenant"])
+					assert.NotContains(t, span.Tags, "baggage.user-id")
+				}
+			}
+		})
+	}
+}
+
+func TestBaggageLimits(t *testing.T) {
+	z := newBaggageZipkin(t, &memReporter{}, func(spec *Spec) {
+		spec.BaggageKeys = []string{"a", "b", "c"}
+		spec.BaggageMaxEntries = 2
+		spec.BaggageMaxBytes = 20
+	})
+
+	span, ctx := z.StartSpanFromCtx(context.Background(), "root")
+	defer span.Finish()
+
+	assert.Nil(t, z.SetBaggage(ctx, "a", "1"))
+	assert.Nil(t, z.SetBaggage(ctx, "b", "2"))
+	assert.Contains(t, z.SetBaggage(ctx, "c", "3").Error(), "max entries")
+
+	// Overwriting an existing key doesn't add an entry.
+	assert.Nil(t, z.SetBaggage(ctx, "a", "0123456789"))
+	assert.Contains(t, z.SetBaggage(ctx, "b", "0123456789").Error(), "max bytes")
+	assert.Equal(t, map[string]string{"a": "0123456789", "b": "2"}, z.Baggage(ctx))
+
+	// The child spans share the baggage of the root span.
+	child := z.StartSpan(span, "child")
+	defer child.Finish()
+	assert.Nil(t, z.SetBaggage(zipkin.NewContext(ctx, child), "b", "3"))
+	assert.Equal(t, "3", z.Baggage(ctx)["b"])
+}
+
+func TestBaggageDisabled(t *testing.T) {
+	z := newPropagationZipkin(t, PropagationB3)
+
+	span, ctx := z.StartSpanFromCtx(context.Background(), "root")
+	defer span.Finish()
+
+	err := z.SetBaggage(ctx, "tenant", "megaease")
+	assert.Contains(t, err.Error(), "disabled")
+	assert.Empty(t, z.Baggage(ctx))
+
+	spec := newTestSpec(&memReporter{})
+	spec.BaggageKeys = []string{"tenant", "bad key"}
+	spec.BaggageTagKeys = []string{"user"}
+	err = spec.Validate()
+	assert.Contains(t, err.Error(), "tracing.baggage.keys")
+	assert.Contains(t, err.Error(), "tracing.baggage.tagKeys")
+}
@@ -0,0 +1,226 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zipkin
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/reporter"
+)
+
+type (
+	// SpanProcessor processes the finished spans before they are sent to the reporter,
+	// such as filtering, mutating and enriching them.
+	SpanProcessor interface {
+		// OnEnd is called with the finished span, which could be modified in place.
+		// The span is dropped if it returns false, and the later processors are skipped.
+		OnEnd(span *model.SpanModel) (keep bool)
+	}
+
+	// SpanProcessorFunc is the adapter to use a function as SpanProcessor.
+	SpanProcessorFunc func(span *model.SpanModel) (keep bool)
+
+	// processingReporter runs the span processors before sending spans to the next reporter.
+	processingReporter struct {
+		next reporter.Reporter
+		// onDrop is called with the dropped spans if not nil.
+		onDrop func(s model.SpanModel)
+
+		mutex sync.RWMutex
+		// declared are the processors declared in the spec, which run first.
+		declared []SpanProcessor
+		// added are the processors registered in code, which are kept across reloading.
+		added []SpanProcessor
+	}
+
+	dropNamesProcessor struct {
+		patterns []*regexp.Regexp
+	}
+
+	renameProcessor struct {
+		names map[string]string
+	}
+
+	tagsProcessor struct {
+		tags map[string]string
+	}
+
+	truncateProcessor struct {
+		maxLength int
+	}
+)
+
+var _ reporter.Reporter = (*processingReporter)(nil)
+
+// OnEnd calls f(span).
+func (f SpanProcessorFunc) OnEnd(span *model.SpanModel) bool {
+	return f(span)
+}
+
+// DropSpansByName returns the processor dropping the spans whose names match any of
+// the patterns case-insensitively, * in the patterns matches any characters.
+func DropSpansByName(patterns ...string) (SpanProcessor, error) {
+	p := &dropNamesProcessor{}
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			return nil, fmt.Errorf("empty span name pattern")
+		}
+
+		expr := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, `.*`)
+		re, err := regexp.Compile("(?i)^" + expr + "$")
+		if err != nil {
+			return nil, fmt.Errorf("compile span name pattern %q failed: %v", pattern, err)
+		}
+		p.patterns = append(p.patterns, re)
+	}
+
+	return p, nil
+}
+
+// RenameSpans returns the processor renaming the spans by the old names to the new ones.
+func RenameSpans(names map[string]string) SpanProcessor {
+	return &renameProcessor{names: names}
+}
+
+// AddTags returns the processor adding the static tags to spans,
+// the tags already set by spans are not overridden.
+func AddTags(tags map[string]string) SpanProcessor {
+	return &tagsProcessor{tags: tags}
+}
+
+// TruncateTagValues returns the processor truncating the tag values longer than
+// maxLength bytes, without breaking UTF-8 characters.
+func TruncateTagValues(maxLength int) SpanProcessor {
+	return &truncateProcessor{maxLength: maxLength}
+}
+
+func (p *dropNamesProcessor) OnEnd(span *model.SpanModel) bool {
+	for _, re := range p.patterns {
+		if re.MatchString(span.Name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *renameProcessor) OnEnd(span *model.SpanModel) bool {
+	if name, exists := p.names[span.Name]; exists {
+		span.Name = name
+	}
+
+	return true
+}
+
+func (p *tagsProcessor) OnEnd(span *model.SpanModel) bool {
+	if span.Tags == nil {
+		span.Tags = make(map[string]string, len(p.tags))
+	}
+	for key, value := range p.tags {
+		if _, exists := span.Tags[key]; !exists {
+			span.Tags[key] = value
+		}
+	}
+
+	return true
+}
+
+func (p *truncateProcessor) OnEnd(span *model.SpanModel) bool {
+	for key, value := range span.Tags {
+		if len(value) <= p.maxLength {
+			continue
+		}
+
+		n := p.maxLength
+		for n > 0 && !utf8.RuneStart(value[n]) {
+			n--
+		}
+		span.Tags[key] = value[:n]
+	}
+
+	return true
+}
+
+// newSpanProcessors returns the processors declared in spec.
+func newSpanProcessors(spec Spec) ([]SpanProcessor, error) {
+	var processors []SpanProcessor
+	if len(spec.ProcessorsDropNames) != 0 {
+		p, err := DropSpansByName(spec.ProcessorsDropNames...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tracing.processors.dropNames: %v", err)
+		}
+		processors = append(processors, p)
+	}
+	if len(spec.ProcessorsRenames) != 0 {
+		processors = append(processors, RenameSpans(spec.ProcessorsRenames))
+	}
+	if len(spec.ProcessorsTags) != 0 {
+		processors = append(processors, AddTags(spec.ProcessorsTags))
+	}
+	if spec.ProcessorsMaxTagValueLength > 0 {
+		processors = append(processors, TruncateTagValues(spec.ProcessorsMaxTagValueLength))
+	}
+
+	return processors, nil
+}
+
+// setDeclared sets the processors declared in spec.
+func (r *processingReporter) setDeclared(processors []SpanProcessor) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.declared = processors
+}
+
+// add appends the processors registered in code.
+func (r *processingReporter) add(processors ...SpanProcessor) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// NOTE: Copy it, so that the processors being run by Send are not changed.
+	r.added = append(append([]SpanProcessor{}, r.added...), processors...)
+}
+
+// Send runs the processors in order, and sends the span unless it's dropped.
+func (r *processingReporter) Send(s model.SpanModel) {
+	r.mutex.RLock()
+	declared, added := r.declared, r.added
+	r.mutex.RUnlock()
+
+	for _, processors := range [][]SpanProcessor{declared, added} {
+		for _, p := range processors {
+			if !p.OnEnd(&s) {
+				if r.onDrop != nil {
+					r.onDrop(s)
+				}
+				return
+			}
+		}
+	}
+
+	r.next.Send(s)
+}
+
+// Close closes the next reporter.
+func (r *processingReporter) Close() error {
+	return r.next.Close()
+}
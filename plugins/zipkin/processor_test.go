@@ -0,0 +1,123 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zipkin
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltinSpanProcessors(t *testing.T) {
+	drop, err := DropSpansByName("GET /health*", "redis.ping")
+	assert.Nil(t, err)
+	assert.False(t, drop.OnEnd(&model.SpanModel{Name: "get /healthz"}))
+	assert.False(t, drop.OnEnd(&model.SpanModel{Name: "redis.ping"}))
+	assert.True(t, drop.OnEnd(&model.SpanModel{Name: "redis+ping"}), "the dot is not a wildcard")
+	assert.True(t, drop.OnEnd(&model.SpanModel{Name: "get /api/health"}))
+
+	_, err = DropSpansByName("")
+	assert.NotNil(t, err)
+
+	span := &model.SpanModel{Name: "http/get"}
+	assert.True(t, RenameSpans(map[string]string{"http/get": "GET"}).OnEnd(span))
+	assert.Equal(t, "GET", span.Name)
+
+	assert.True(t, AddTags(map[string]string{"env": "prod", "zone": "a"}).OnEnd(span))
+	assert.Equal(t, map[string]string{"env": "prod", "zone": "a"}, span.Tags)
+	span.Tags["zone"] = "b"
+	AddTags(map[string]string{"zone": "a"}).OnEnd(span)
+	assert.Equal(t, "b", span.Tags["zone"], "the tags set by spans are not overridden")
+
+	span.Tags = map[string]string{"sql": strings.Repeat("a", 10), "name": "中文"}
+	assert.True(t, TruncateTagValues(4).OnEnd(span))
+	assert.Equal(t, "aaaa", span.Tags["sql"])
+	assert.Equal(t, "中", span.Tags["name"], "UTF-8 characters are not broken")
+}
+
+func TestSpanProcessorPipeline(t *testing.T) {
+	rep := &memReporter{}
+	spec := newTestSpec(rep)
+	spec.ProcessorsDropNames = []string{"noise*"}
+	spec.ProcessorsRenames = map[string]string{"old": "new"}
+	spec.ProcessorsTags = map[string]string{"env": "dev"}
+	spec.ProcessorsMaxTagValueLength = 3
+	assert.Nil(t, spec.Validate())
+
+	plug, err := New(spec)
+	assert.Nil(t, err)
+	z := plug.(*Zipkin)
+
+	// The processors registered in code run after the declared ones.
+	var names []string
+	z.AddSpanProcessors(SpanProcessorFunc(func(span *model.SpanModel) bool {
+		names = append(names, span.Name)
+		return span.Tags["drop"] == ""
+	}))
+
+	span := z.StartSpan(nil, "old")
+	span.Tag("sql", "select")
+	span.Finish()
+	z.StartSpan(nil, "noise").Finish()
+	span = z.StartSpan(nil, "dropped")
+	span.Tag("drop", "true")
+	span.Finish()
+
+	assert.Equal(t, []string{"new", "dropped"}, names)
+	assert.Len(t, rep.spans, 1)
+	assert.Equal(t, "new", rep.spans[0].Name)
+	assert.Equal(t, map[string]string{"env": "dev", "sql": "sel"}, rep.spans[0].Tags)
+
+	// The declared processors follow the spec, and the ones registered in code are kept.
+	spec.ProcessorsDropNames = nil
+	assert.Nil(t, z.Reload(spec))
+	z.StartSpan(nil, "noise").Finish()
+	assert.Equal(t, []string{"new", "dropped", "noise"}, names)
+	assert.Len(t, rep.spans, 2)
+
+	spec.ProcessorsDropNames = []string{" "}
+	assert.Contains(t, spec.Validate().Error(), "tracing.processors.dropNames")
+}
+
+func TestSpanProcessorsBeforeTailSampling(t *testing.T) {
+	rep := &memReporter{}
+	spec := newTestSpec(rep)
+	spec.ProcessorsDropNames = []string{"noise*", "health"}
+	spec.TailSamplingEnable = true
+	spec.TailSamplingBaseRate = 1
+	spec.TailSamplingMaxSpansPerTrace = 2
+
+	plug, err := New(spec)
+	assert.Nil(t, err)
+	z := plug.(*Zipkin)
+	defer z.Close()
+
+	// The dropped spans don't take the buffer of tail sampling.
+	root := z.StartSpan(nil, "root")
+	z.StartSpan(root, "noise").Finish()
+	z.StartSpan(root, "query").Finish()
+	root.Finish()
+	assert.Equal(t, uint64(0), z.TailSamplingStats().DroppedSpans)
+	assert.Len(t, rep.traceIDs(), 2)
+
+	// The trace of the dropped local root span is decided at once.
+	root = z.StartSpan(nil, "health")
+	root.Finish()
+	assert.Equal(t, 0, z.TailSamplingStats().Buffered)
+}
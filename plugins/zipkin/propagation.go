@@ -0,0 +1,222 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zipkin
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/propagation/b3"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// PropagationB3 is the B3 multiple headers such as X-B3-TraceId.
+	PropagationB3 = "b3"
+	// PropagationB3Single is the B3 single header b3.
+	PropagationB3Single = "b3single"
+	// PropagationW3C is the W3C Trace Context headers traceparent and tracestate.
+	PropagationW3C = "w3c"
+
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+)
+
+var (
+	propagationFormats = []string{PropagationB3, PropagationB3Single, PropagationW3C}
+
+	b3Headers = []string{b3.TraceID, b3.SpanID, b3.ParentSpanID, b3.Sampled, b3.Flags, b3.Context}
+)
+
+type (
+	tracestateContextKey struct{}
+
+	// propagationTransport translates the B3 headers injected by zipkinhttp
+	// into the configured propagation formats.
+	propagationTransport struct {
+		formats []string
+		base    http.RoundTripper
+	}
+)
+
+// isDefaultPropagation returns whether the formats are the ones of zipkinhttp,
+// which need no translation.
+func isDefaultPropagation(formats []string) bool {
+	return len(formats) == 0 || (len(formats) == 1 && formats[0] == PropagationB3)
+}
+
+// extractSpanContext extracts the span context by the formats in order,
+// it returns nil if none of the formats is present or valid.
+func extractSpanContext(formats []string, h http.Header) (*model.SpanContext, string) {
+	for _, format := range formats {
+		var sc *model.SpanContext
+		var err error
+
+		switch format {
+		case PropagationB3:
+			if h.Get(b3.TraceID) == "" && h.Get(b3.Sampled) == "" && h.Get(b3.Flags) == "" {
+				continue
+			}
+			sc, err = b3.ParseHeaders(h.Get(b3.TraceID), h.Get(b3.SpanID),
+				h.Get(b3.ParentSpanID), h.Get(b3.Sampled), h.Get(b3.Flags))
+		case PropagationB3Single:
+			if h.Get(b3.Context) == "" {
+				continue
+			}
+			sc, err = b3.ParseSingleHeader(h.Get(b3.Context))
+		case PropagationW3C:
+			if h.Get(traceparentHeader) == "" {
+				continue
+			}
+			sc, err = parseTraceparent(h.Get(traceparentHeader))
+		}
+
+		if err == nil && sc != nil {
+			return sc, format
+		}
+	}
+
+	return nil, ""
+}
+
+// extractRequest returns the request whose span context extracted by the formats
+// is translated into B3 multiple headers for zipkinhttp.
+func extractRequest(formats []string, r *http.Request) *http.Request {
+	sc, format := extractSpanContext(formats, r.Header)
+
+	ctx := r.Context()
+	if format == PropagationW3C && r.Header.Get(tracestateHeader) != "" {
+		ctx = context.WithValue(ctx, tracestateContextKey{}, r.Header.Get(tracestateHeader))
+	}
+
+	r = r.Clone(ctx)
+	for _, header := range b3Headers {
+		r.Header.Del(header)
+	}
+	if sc != nil {
+		_ = b3.InjectHTTP(r)(*sc)
+	}
+
+	return r
+}
+
+// withTracestate returns ctx carrying the tracestate of parent if any.
+func withTracestate(ctx, parent context.Context) context.Context {
+	if parent == nil {
+		return ctx
+	}
+
+	tracestate, ok := parent.Value(tracestateContextKey{}).(string)
+	if !ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, tracestateContextKey{}, tracestate)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *propagationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	sc, _ := extractSpanContext([]string{PropagationB3}, req.Header)
+	if sc == nil {
+		return base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	if slices.Contains(t.formats, PropagationB3Single) {
+		req.Header.Set(b3.Context, b3.BuildSingleHeader(*sc))
+	}
+	if slices.Contains(t.formats, PropagationW3C) {
+		req.Header.Set(traceparentHeader, buildTraceparent(*sc))
+		if tracestate, ok := req.Context().Value(tracestateContextKey{}).(string); ok {
+			req.Header.Set(tracestateHeader, tracestate)
+		}
+	}
+	if !slices.Contains(t.formats, PropagationB3) {
+		for _, header := range []string{b3.TraceID, b3.SpanID, b3.ParentSpanID, b3.Sampled, b3.Flags} {
+			req.Header.Del(header)
+		}
+	}
+
+	return base.RoundTrip(req)
+}
+
+// parseTraceparent parses the W3C traceparent header: {version}-{trace-id}-{parent-id}-{trace-flags}.
+func parseTraceparent(value string) (*model.SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || (parts[0] == "00" && len(parts) != 4) {
+		return nil, fmt.Errorf("invalid traceparent %q", value)
+	}
+
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isLowerHex(version, 2) || version == "ff" || !isLowerHex(traceID, 32) ||
+		!isLowerHex(spanID, 16) || !isLowerHex(flags, 2) {
+		return nil, fmt.Errorf("invalid traceparent %q", value)
+	}
+
+	sc := &model.SpanContext{}
+	var err error
+	sc.TraceID, err = model.TraceIDFromHex(traceID)
+	if err != nil || sc.TraceID.Empty() {
+		return nil, fmt.Errorf("invalid trace id of traceparent %q", value)
+	}
+
+	id, err := strconv.ParseUint(spanID, 16, 64)
+	if err != nil || id == 0 {
+		return nil, fmt.Errorf("invalid parent id of traceparent %q", value)
+	}
+	sc.ID = model.ID(id)
+
+	flagsByte, _ := hex.DecodeString(flags)
+	sampled := flagsByte[0]&0x01 == 0x01
+	sc.Sampled = &sampled
+
+	return sc, nil
+}
+
+// buildTraceparent builds the W3C traceparent header, the 64 bits trace id is left padded with zeros.
+func buildTraceparent(sc model.SpanContext) string {
+	flags := "00"
+	if sc.Debug || (sc.Sampled != nil && *sc.Sampled) {
+		flags = "01"
+	}
+
+	return fmt.Sprintf("00-%016x%016x-%016x-%s", sc.TraceID.High, sc.TraceID.Low, uint64(sc.ID), flags)
+}
+
+func isLowerHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,206 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zipkin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/propagation/b3"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPropagationZipkin(t *testing.T, formats ...string) *Zipkin {
+	spec := newTestSpec(&memReporter{})
+	spec.Propagation = formats
+	assert.Nil(t, spec.Validate())
+
+	plug, err := New(spec)
+	assert.Nil(t, err)
+
+	return plug.(*Zipkin)
+}
+
+func TestTraceparent(t *testing.T) {
+	sc, err := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Nil(t, err)
+	assert.Equal(t, model.TraceID{High: 0x4bf92f3577b34da6, Low: 0xa3ce929d0e0e4736}, sc.TraceID)
+	assert.Equal(t, model.ID(0x00f067aa0ba902b7), sc.ID)
+	assert.True(t, *sc.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", buildTraceparent(*sc))
+
+	sampled := false
+	sc = &model.SpanContext{TraceID: model.TraceID{Low: 1}, ID: 2, Sampled: &sampled}
+	assert.Equal(t, "00-00000000000000000000000000000001-0000000000000002-00", buildTraceparent(*sc))
+
+	// The future versions could append fields.
+	_, err = parseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future")
+	assert.Nil(t, err)
+
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6-00f067aa0ba902b7-01",
+	} {
+		_, err := parseTraceparent(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestExtractInOrder(t *testing.T) {
+	h := http.Header{}
+	h.Set(traceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set(b3.TraceID, "0000000000000001")
+	h.Set(b3.SpanID, "0000000000000002")
+	h.Set(b3.Sampled, "1")
+
+	sc, format := extractSpanContext([]string{PropagationW3C, PropagationB3}, h)
+	assert.Equal(t, PropagationW3C, format)
+	assert.Equal(t, uint64(0xa3ce929d0e0e4736), sc.TraceID.Low)
+
+	sc, format = extractSpanContext([]string{PropagationB3, PropagationW3C}, h)
+	assert.Equal(t, PropagationB3, format)
+	assert.Equal(t, uint64(1), sc.TraceID.Low)
+
+	// The invalid format falls back to the next one.
+	h.Set(traceparentHeader, "invalid")
+	_, format = extractSpanContext([]string{PropagationW3C, PropagationB3}, h)
+	assert.Equal(t, PropagationB3, format)
+
+	sc, format = extractSpanContext([]string{PropagationB3Single}, h)
+	assert.Nil(t, sc)
+	assert.Empty(t, format)
+}
+
+// TestPropagationRoundTrip sends the request in one format to the upstream service,
+// which calls the downstream service in other formats.
+func TestPropagationRoundTrip(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	cases := []struct {
+		name     string
+		formats  []string
+		inbound  http.Header
+		traceID  string
+		injected []string
+		absent   []string
+	}{
+		{
+			name:     "w3c to all",
+			formats:  []string{PropagationW3C, PropagationB3, PropagationB3Single},
+			inbound:  http.Header{"Traceparent": {traceparent}, "Tracestate": {"vendor=value"}},
+			traceID:  "4bf92f3577b34da6a3ce929d0e0e4736",
+			injected: []string{traceparentHeader, tracestateHeader, b3.TraceID, b3.Context},
+		},
+		{
+			name:     "b3 ignored with w3c only",
+			formats:  []string{PropagationW3C},
+			inbound:  http.Header{"X-B3-Traceid": {"463ac35c9f6413ad"}, "X-B3-Spanid": {"72485a3953bb6124"}, "X-B3-Sampled": {"1"}},
+			injected: []string{traceparentHeader},
+			absent:   []string{b3.TraceID, b3.Context, tracestateHeader},
+		},
+		{
+			name:     "b3single to b3 and w3c",
+			formats:  []string{PropagationB3Single, PropagationB3, PropagationW3C},
+			inbound:  http.Header{"B3": {"463ac35c9f6413ad-72485a3953bb6124-1"}},
+			traceID:  "463ac35c9f6413ad",
+			injected: []string{traceparentHeader, b3.TraceID},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var outbound http.Header
+			downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				outbound = r.Header.Clone()
+			}))
+			defer downstream.Close()
+
+			z := newPropagationZipkin(t, c.formats...)
+			client := z.WrapUserClient(downstream.Client())
+
+			var serverSpan model.SpanContext
+			handler := z.WrapUserHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverSpan = zipkin.SpanFromContext(r.Context()).Context()
+
+				req, err := http.NewRequest(http.MethodGet, downstream.URL, nil)
+				assert.Nil(t, err)
+				resp, err := client.Do(z.WrapUserClientRequest(r.Context(), req))
+				if assert.Nil(t, err) {
+					resp.Body.Close()
+				}
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header = c.inbound
+			handler(httptest.NewRecorder(), req)
+
+			if c.traceID != "" {
+				assert.Equal(t, c.traceID, serverSpan.TraceID.String())
+			}
+			for _, header := range c.injected {
+				assert.NotEmpty(t, outbound.Get(header), header)
+			}
+			for _, header := range c.absent {
+				assert.Empty(t, outbound.Get(header), header)
+			}
+
+			// The downstream extracts the same trace in every injected format.
+			for _, format := range c.formats {
+				sc, got := extractSpanContext([]string{format}, outbound)
+				if assert.Equal(t, format, got) {
+					assert.Equal(t, serverSpan.TraceID, sc.TraceID)
+					assert.NotEqual(t, serverSpan.ID, sc.ID, "the client span is the parent of downstream")
+				}
+			}
+			if c.inbound.Get(tracestateHeader) != "" {
+				assert.Equal(t, c.inbound.Get(tracestateHeader), outbound.Get(tracestateHeader))
+			}
+		})
+	}
+}
+
+func TestDefaultPropagation(t *testing.T) {
+	z := newPropagationZipkin(t, PropagationB3)
+
+	original := &http.Client{}
+	z.WrapUserClient(original)
+	assert.Nil(t, original.Transport, "the user's client must not be modified")
+
+	var traceID string
+	z.WrapUserHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID = zipkin.SpanFromContext(r.Context()).Context().TraceID.String()
+	})(httptest.NewRecorder(), func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(traceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		return req.WithContext(context.Background())
+	}())
+	assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID, "w3c is not extracted by default")
+
+	spec := newTestSpec(&memReporter{})
+	spec.Propagation = []string{"jaeger"}
+	assert.Contains(t, spec.Validate().Error(), "tracing.propagation")
+}
@@ -24,6 +24,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/openzipkin/zipkin-go/model"
@@ -40,6 +41,14 @@ type (
 		next http.RoundTripper
 	}
 
+	// swapReporter forwards spans to the underlying reporter which could be swapped,
+	// and drops spans after it's closed instead of blocking the senders.
+	swapReporter struct {
+		mutex    sync.RWMutex
+		reporter reporter.Reporter
+		closed   bool
+	}
+
 	// logReporter will send spans to the default Go Logger.
 	logReporter struct {
 		logger     *log.Logger
@@ -48,6 +57,10 @@ type (
 )
 
 func newReporter(spec Spec) (reporter.Reporter, error) {
+	if spec.Reporter != nil {
+		return spec.Reporter, nil
+	}
+
 	if spec.OutputServerURL == "" {
 		return newLogReporter(spec), nil
 	}
@@ -65,17 +78,32 @@ func newReporter(spec Spec) (reporter.Reporter, error) {
 
 func newHTTPClient(spec Spec) (*http.Client, error) {
 	transport := http.DefaultTransport
-	if spec.EnableTLS {
-		tlsConfig, err := newTLSConfig([]byte(spec.TLSCert), []byte(spec.TLSKey), []byte(spec.TLSCaCert))
-		if err != nil {
-			return nil, fmt.Errorf("create tls config failed: %v", err)
-		}
+	tlsConfig, err := spec.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
 		transport = &http.Transport{TLSClientConfig: tlsConfig}
 	}
 	transport = newAuthTransport(spec, transport)
 	return &http.Client{Transport: transport}, nil
 }
 
+// TLSConfig returns the tls config of the output server, it returns nil if tls is disabled.
+// The other clients of MegaEase Cloud could share the same mTLS material.
+func (spec Spec) TLSConfig() (*tls.Config, error) {
+	if !spec.EnableTLS {
+		return nil, nil
+	}
+
+	tlsConfig, err := newTLSConfig([]byte(spec.TLSCert), []byte(spec.TLSKey), []byte(spec.TLSCaCert))
+	if err != nil {
+		return nil, fmt.Errorf("create tls config failed: %v", err)
+	}
+
+	return tlsConfig, nil
+}
+
 func newAuthTransport(spec Spec, next http.RoundTripper) http.RoundTripper {
 	if !spec.EnableBasicAuth {
 		return next
@@ -132,3 +160,39 @@ func (r *logReporter) Send(s model.SpanModel) {
 
 // Close closes the reporter
 func (*logReporter) Close() error { return nil }
+
+// Send forwards the span to the underlying reporter.
+func (r *swapReporter) Send(s model.SpanModel) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.closed || r.reporter == nil {
+		return
+	}
+
+	r.reporter.Send(s)
+}
+
+// swap sets the underlying reporter and returns the old one.
+func (r *swapReporter) swap(reporter reporter.Reporter) reporter.Reporter {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	old := r.reporter
+	r.reporter = reporter
+	return old
+}
+
+// Close closes the underlying reporter.
+func (r *swapReporter) Close() error {
+	r.mutex.Lock()
+	r.closed = true
+	reporter := r.reporter
+	r.mutex.Unlock()
+
+	if reporter == nil {
+		return nil
+	}
+
+	return reporter.Close()
+}
@@ -0,0 +1,182 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zipkin
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openzipkin/zipkin-go/propagation/b3"
+)
+
+const (
+	// SamplerBoundary samples the root traces at tracing.sample.rate.
+	SamplerBoundary = "boundary"
+	// SamplerRateLimiting samples at most tracing.sampler.tracesPerSecond root traces per second.
+	SamplerRateLimiting = "rateLimiting"
+	// SamplerRule samples the requests matching tracing.sampler.rules at their own rates,
+	// and the others at tracing.sample.rate.
+	SamplerRule = "rule"
+)
+
+type (
+	// ruleSampling is the sample rate of the server requests matching the method and the path glob.
+	ruleSampling struct {
+		method string
+		glob   string
+		rate   float64
+	}
+
+	// rateLimitingSampler is the token bucket refilled with perSecond tokens every second,
+	// each sampled trace takes a token.
+	rateLimitingSampler struct {
+		mutex     sync.Mutex
+		now       func() time.Time
+		perSecond float64
+		tokens    float64
+		last      time.Time
+	}
+)
+
+func newRateLimitingSampler(perSecond float64, now func() time.Time) *rateLimitingSampler {
+	return &rateLimitingSampler{
+		now:       now,
+		perSecond: perSecond,
+		tokens:    rateLimitingCapacity(perSecond),
+		last:      now(),
+	}
+}
+
+func rateLimitingCapacity(perSecond float64) float64 {
+	if perSecond < 1 {
+		return 1
+	}
+
+	return perSecond
+}
+
+// sample implements zipkin.Sampler.
+func (s *rateLimitingSampler) sample(id uint64) bool {
+	if s.perSecond <= 0 {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	if elapsed := now.Sub(s.last).Seconds(); elapsed > 0 {
+		s.tokens += elapsed * s.perSecond
+		if capacity := rateLimitingCapacity(s.perSecond); s.tokens > capacity {
+			s.tokens = capacity
+		}
+		s.last = now
+	}
+
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+
+	return true
+}
+
+// parseRules parses the rules in the form of "[METHOD ]glob=rate", such as
+// "GET /checkout=1" and "/healthz=0". The glob is matched by path.Match,
+// so * matches a path segment.
+func parseRules(rules []string) ([]*ruleSampling, error) {
+	result := make([]*ruleSampling, 0, len(rules))
+	for _, item := range rules {
+		i := strings.LastIndex(item, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid rule %q: want [METHOD ]glob=rate", item)
+		}
+		rate, err := parseRate(strings.TrimSpace(item[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %v", item, err)
+		}
+
+		rule := &ruleSampling{rate: rate}
+		fields := strings.Fields(item[:i])
+		switch len(fields) {
+		case 1:
+			rule.glob = fields[0]
+		case 2:
+			rule.method, rule.glob = strings.ToUpper(fields[0]), fields[1]
+		default:
+			return nil, fmt.Errorf("invalid rule %q: want [METHOD ]glob=rate", item)
+		}
+
+		if !strings.HasPrefix(rule.glob, "/") {
+			return nil, fmt.Errorf("invalid rule %q: want glob starting with /", item)
+		}
+		if _, err := path.Match(rule.glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %v", item, err)
+		}
+
+		result = append(result, rule)
+	}
+
+	return result, nil
+}
+
+// match returns true if the request matches the method and the path glob of the rule.
+func (rule *ruleSampling) match(r *http.Request) bool {
+	if rule.method != "" && rule.method != r.Method {
+		return false
+	}
+
+	matched, _ := path.Match(rule.glob, r.URL.Path)
+	return matched
+}
+
+// validateSampler validates the sampler settings of spec.
+func validateSampler(spec Spec) []string {
+	var msgs []string
+	if spec.SamplerType == SamplerRule && len(spec.SamplerRules) == 0 {
+		msgs = append(msgs, "tracing.sampler.rules are not specified")
+	}
+
+	if _, err := parseRules(spec.SamplerRules); err != nil {
+		msgs = append(msgs, fmt.Sprintf("invalid tracing.sampler.rules: %v", err))
+	}
+
+	return msgs
+}
+
+// hasUpstreamDecision returns true if the request carries the sampling decision of upstream,
+// the other propagation formats are translated to B3 before sampling.
+func hasUpstreamDecision(r *http.Request) bool {
+	if r.Header.Get(b3.Sampled) != "" || r.Header.Get(b3.Flags) == "1" {
+		return true
+	}
+
+	// The single header is {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId} or {SamplingState}.
+	parts := strings.Split(r.Header.Get(b3.Context), "-")
+	switch len(parts) {
+	case 1:
+		return parts[0] != ""
+	case 2:
+		return false
+	default:
+		return parts[2] != ""
+	}
+}
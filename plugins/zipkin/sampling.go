@@ -0,0 +1,256 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zipkin
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	zipkingo "github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/propagation/b3"
+)
+
+const (
+	// enableKey, sampleRateKey, samplePathsKey and overrideUpstreamKey are the keys
+	// of agent config pushed to the agent endpoint /config.
+	enableKey           = "tracing.enable"
+	sampleRateKey       = "tracing.sample.rate"
+	samplePathsKey      = "tracing.sample.paths"
+	overrideUpstreamKey = "tracing.sample.overrideUpstream"
+)
+
+type (
+	// sampling is the effective sampling settings, which are the ones of the spec
+	// overridden by the agent config pushed to the agent endpoint /config.
+	sampling struct {
+		enable      bool
+		rate        float64
+		samplerType string
+		// overrideUpstream makes enable, paths and rules apply to the requests
+		// carrying the decisions of upstream too.
+		overrideUpstream bool
+		sampler          zipkingo.Sampler
+		// limiter is the bucket of the rateLimiting sampler, which is kept
+		// across reloading if tracing.sampler.tracesPerSecond is unchanged.
+		limiter *rateLimitingSampler
+		// paths are sorted by the length of patterns descending,
+		// so the longest pattern matches first.
+		paths []*pathSampling
+		// rules are matched in order after paths.
+		rules []*ruleSampling
+	}
+
+	// pathSampling is the sample rate of the requests whose path matches the pattern,
+	// the pattern ending with * matches the prefix, otherwise matches the whole path.
+	pathSampling struct {
+		pattern string
+		rate    float64
+	}
+)
+
+// newSampling returns the sampling of the spec overridden by the agent config,
+// the rate limiter of the previous sampling is kept if its settings are unchanged.
+func newSampling(spec Spec, config map[string]string, previous *sampling) (*sampling, error) {
+	s := &sampling{
+		enable:      spec.EnableTracing,
+		rate:        spec.SampleRate,
+		samplerType: spec.SamplerType,
+
+		overrideUpstream: spec.SampleOverrideUpstream,
+	}
+
+	if value, exists := config[enableKey]; exists {
+		enable, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: want bool", enableKey, value)
+		}
+		s.enable = enable
+	}
+
+	if value, exists := config[overrideUpstreamKey]; exists {
+		overrideUpstream, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: want bool", overrideUpstreamKey, value)
+		}
+		s.overrideUpstream = overrideUpstream
+	}
+
+	if value, exists := config[sampleRateKey]; exists {
+		rate, err := parseRate(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", sampleRateKey, value, err)
+		}
+		s.rate = rate
+	}
+
+	if value, exists := config[samplePathsKey]; exists {
+		paths, err := parsePaths(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", samplePathsKey, value, err)
+		}
+		s.paths = paths
+	}
+
+	if s.samplerType == SamplerRule {
+		rules, err := parseRules(spec.SamplerRules)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tracing.sampler.rules: %v", err)
+		}
+		s.rules = rules
+	}
+
+	s.sampler = zipkingo.NeverSample
+	if s.enable && spec.TailSamplingEnable {
+		// NOTE: The tail sampler applies tracing.tailSampling.baseRate instead.
+		s.sampler = zipkingo.AlwaysSample
+	} else if s.enable && s.samplerType == SamplerRateLimiting {
+		if previous != nil && previous.limiter != nil &&
+			previous.limiter.perSecond == spec.SamplerTracesPerSecond {
+			s.limiter = previous.limiter
+		} else {
+			s.limiter = newRateLimitingSampler(spec.SamplerTracesPerSecond, time.Now)
+		}
+		s.sampler = s.limiter.sample
+	} else if s.enable {
+		sampler, err := zipkingo.NewBoundarySampler(s.rate, time.Now().Unix())
+		if err != nil {
+			return nil, fmt.Errorf("new sampler failed: %v", err)
+		}
+		s.sampler = sampler
+	}
+
+	return s, nil
+}
+
+func parseRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("want number in range [0, 1]")
+	}
+
+	return rate, nil
+}
+
+// parsePaths parses the sample rates of paths in the form of "/health=0,/api/*=0.1".
+func parsePaths(value string) ([]*pathSampling, error) {
+	paths := []*pathSampling{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		i := strings.LastIndex(item, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("want path=rate")
+		}
+		rate, err := parseRate(strings.TrimSpace(item[i+1:]))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, &pathSampling{pattern: strings.TrimSpace(item[:i]), rate: rate})
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool {
+		return len(paths[i].pattern) > len(paths[j].pattern)
+	})
+
+	return paths, nil
+}
+
+// sample is the sampler of the tracer.
+func (s *sampling) sample(id uint64) bool {
+	return s.sampler(id)
+}
+
+// sampleRequest returns the sampling decision of the server request. The decision of
+// upstream is kept unless overrideUpstream is set, so the traces across services are
+// not broken. It returns nil to keep the decision of upstream or the tracer.
+// The paths and rules decide from the trace id, so the services sharing them
+// make the same decision on a trace.
+func (s *sampling) sampleRequest(r *http.Request) *bool {
+	if !s.overrideUpstream && hasUpstreamDecision(r) {
+		return nil
+	}
+
+	sampled := false
+	if !s.enable {
+		return &sampled
+	}
+
+	for _, path := range s.paths {
+		if path.match(r.URL.Path) {
+			sampled = sampleTraceID(requestTraceID(r), path.rate)
+			return &sampled
+		}
+	}
+
+	for _, rule := range s.rules {
+		if rule.match(r) {
+			sampled = sampleTraceID(requestTraceID(r), rule.rate)
+			return &sampled
+		}
+	}
+
+	return nil
+}
+
+// requestTraceID returns the low 64 bits of the trace id carried by the request.
+// The trace id of a new trace is generated by the tracer after sampling, which is random,
+// so a random id is used for the request without trace id.
+func requestTraceID(r *http.Request) uint64 {
+	sc, err := b3.ExtractHTTP(r)()
+	if err != nil || sc == nil || sc.TraceID.Empty() {
+		return rand.Uint64()
+	}
+
+	return sc.TraceID.Low
+}
+
+// sampleTraceID returns true if the trace id falls in the rate,
+// it maps the high 53 bits of id to [0, 1).
+func sampleTraceID(id uint64, rate float64) bool {
+	return float64(id>>11)/(1<<53) < rate
+}
+
+// config returns the effective values in the form of agent config.
+func (s *sampling) config() map[string]string {
+	paths := make([]string, 0, len(s.paths))
+	for _, path := range s.paths {
+		paths = append(paths, path.pattern+"="+strconv.FormatFloat(path.rate, 'f', -1, 64))
+	}
+	sort.Strings(paths)
+
+	return map[string]string{
+		enableKey:           strconv.FormatBool(s.enable),
+		sampleRateKey:       strconv.FormatFloat(s.rate, 'f', -1, 64),
+		samplePathsKey:      strings.Join(paths, ","),
+		overrideUpstreamKey: strconv.FormatBool(s.overrideUpstream),
+	}
+}
+
+func (p *pathSampling) match(path string) bool {
+	if strings.HasSuffix(p.pattern, "*") {
+		return strings.HasPrefix(path, strings.TrimSuffix(p.pattern, "*"))
+	}
+
+	return path == p.pattern
+}
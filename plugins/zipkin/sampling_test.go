@@ -0,0 +1,278 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zipkin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePaths(t *testing.T) {
+	paths, err := parsePaths("/api/*=0.1, /api/users=1,/*=0.5,")
+	assert.Nil(t, err)
+	assert.Equal(t, []*pathSampling{
+		{pattern: "/api/users", rate: 1},
+		{pattern: "/api/*", rate: 0.1},
+		{pattern: "/*", rate: 0.5},
+	}, paths)
+
+	assert.True(t, paths[1].match("/api/orders"))
+	assert.False(t, paths[0].match("/api/users/1"))
+
+	for _, value := range []string{"/api", "=1", "/api=high", "/api=1.5"} {
+		_, err := parsePaths(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestApplyAgentConfig(t *testing.T) {
+	plug, err := New(newTestSpec(&memReporter{}))
+	assert.Nil(t, err)
+	z := plug.(*Zipkin)
+
+	err = z.ApplyAgentConfig(map[string]string{"tracing.sample.paths": "/health=0", "other": "ignored"})
+	assert.Nil(t, err)
+
+	sampled := z.sampleRequest(httptest.NewRequest("GET", "/health", nil))
+	assert.False(t, *sampled)
+	assert.Nil(t, z.sampleRequest(httptest.NewRequest("GET", "/api", nil)))
+
+	// The agent config is kept across reloading spec.
+	spec := newTestSpec(&memReporter{})
+	spec.SampleRate = 0.5
+	assert.Nil(t, z.Reload(spec))
+	assert.Equal(t, map[string]string{
+		"tracing.enable":                  "true",
+		"tracing.sample.rate":             "0.5",
+		"tracing.sample.paths":            "/health=0",
+		"tracing.sample.overrideUpstream": "false",
+	}, z.AgentConfig())
+
+	// Disabling tracing overrides the decision of upstream.
+	assert.Nil(t, z.ApplyAgentConfig(map[string]string{"tracing.enable": "false"}))
+	sampled = z.sampleRequest(httptest.NewRequest("GET", "/api", nil))
+	assert.False(t, *sampled)
+	assert.False(t, z.sample(1))
+
+	assert.NotNil(t, z.ApplyAgentConfig(map[string]string{"tracing.enable": "no"}))
+	assert.Equal(t, "false", z.AgentConfig()["tracing.enable"])
+}
+
+func TestUpstreamDecision(t *testing.T) {
+	plug, err := New(newTestSpec(&memReporter{}))
+	assert.Nil(t, err)
+	z := plug.(*Zipkin)
+
+	upstream := func(sampled string) *http.Request {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set("X-B3-TraceId", "463ac35c9f6413ad")
+		req.Header.Set("X-B3-SpanId", "72485a3953bb6124")
+		req.Header.Set("X-B3-Sampled", sampled)
+		return req
+	}
+
+	// The paths and the switch only apply to the root requests by default.
+	assert.Nil(t, z.ApplyAgentConfig(map[string]string{"tracing.sample.paths": "/health=0"}))
+	assert.Nil(t, z.sampleRequest(upstream("1")))
+	assert.Nil(t, z.ApplyAgentConfig(map[string]string{"tracing.enable": "false"}))
+	assert.Nil(t, z.sampleRequest(upstream("1")))
+	sampled := z.sampleRequest(httptest.NewRequest("GET", "/api", nil))
+	assert.False(t, *sampled)
+
+	// Overriding upstream applies them to all requests.
+	assert.Nil(t, z.ApplyAgentConfig(map[string]string{"tracing.sample.overrideUpstream": "true"}))
+	sampled = z.sampleRequest(upstream("1"))
+	assert.False(t, *sampled)
+	assert.Nil(t, z.ApplyAgentConfig(map[string]string{"tracing.enable": "true"}))
+	sampled = z.sampleRequest(upstream("1"))
+	assert.False(t, *sampled, "the path wins")
+
+	assert.NotNil(t, z.ApplyAgentConfig(map[string]string{"tracing.sample.overrideUpstream": "yes"}))
+}
+
+func newSamplerZipkin(t *testing.T, update func(spec *Spec)) *Zipkin {
+	spec := newTestSpec(&memReporter{})
+	update(&spec)
+	assert.Nil(t, spec.Validate())
+
+	plug, err := New(spec)
+	assert.Nil(t, err)
+
+	return plug.(*Zipkin)
+}
+
+func TestRateLimitingSampler(t *testing.T) {
+	now := time.Unix(0, 0)
+	sampler := newRateLimitingSampler(2, func() time.Time { return now })
+
+	// The bucket starts full.
+	assert.True(t, sampler.sample(1))
+	assert.True(t, sampler.sample(2))
+	assert.False(t, sampler.sample(3))
+
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, sampler.sample(4))
+	assert.False(t, sampler.sample(5))
+
+	// The tokens don't exceed the capacity after idling.
+	now = now.Add(time.Minute)
+	assert.True(t, sampler.sample(6))
+	assert.True(t, sampler.sample(7))
+	assert.False(t, sampler.sample(8))
+
+	// Less than one trace per second.
+	sampler = newRateLimitingSampler(0.5, func() time.Time { return now })
+	assert.True(t, sampler.sample(1))
+	now = now.Add(time.Second)
+	assert.False(t, sampler.sample(2))
+	now = now.Add(time.Second)
+	assert.True(t, sampler.sample(3))
+
+	sampler = newRateLimitingSampler(0, func() time.Time { return now })
+	assert.False(t, sampler.sample(1))
+
+	z := newSamplerZipkin(t, func(spec *Spec) {
+		spec.SamplerType = SamplerRateLimiting
+		spec.SamplerTracesPerSecond = 1
+	})
+	assert.True(t, z.sample(1))
+	assert.False(t, z.sample(2))
+
+	// The bucket is kept unless tracesPerSecond changes.
+	assert.Nil(t, z.ApplyAgentConfig(map[string]string{"tracing.sample.paths": "/healthz=0"}))
+	assert.False(t, z.sample(3))
+	spec := z.load().spec
+	assert.Nil(t, z.Reload(spec))
+	assert.False(t, z.sample(4))
+	spec.SamplerTracesPerSecond = 2
+	assert.Nil(t, z.Reload(spec))
+	assert.True(t, z.sample(5))
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := parseRules([]string{"get /checkout/*=1", " /healthz = 0 "})
+	assert.Nil(t, err)
+	assert.Equal(t, []*ruleSampling{
+		{method: "GET", glob: "/checkout/*", rate: 1},
+		{glob: "/healthz", rate: 0},
+	}, rules)
+
+	assert.True(t, rules[0].match(httptest.NewRequest("GET", "/checkout/1", nil)))
+	assert.False(t, rules[0].match(httptest.NewRequest("POST", "/checkout/1", nil)))
+	assert.False(t, rules[0].match(httptest.NewRequest("GET", "/checkout/1/items", nil)))
+	assert.True(t, rules[1].match(httptest.NewRequest("HEAD", "/healthz", nil)))
+
+	for _, value := range []string{"/api", "=1", "/api=high", "GET POST /api=1", "api=1", "/[api=1"} {
+		_, err := parseRules([]string{value})
+		assert.NotNil(t, err, value)
+	}
+
+	spec := newTestSpec(&memReporter{})
+	spec.SamplerType = SamplerRule
+	assert.Contains(t, spec.Validate().Error(), "tracing.sampler.rules are not specified")
+	spec.SamplerType = "adaptive"
+	assert.Contains(t, spec.Validate().Error(), "tracing.sampler.type")
+}
+
+func TestRuleSampler(t *testing.T) {
+	z := newSamplerZipkin(t, func(spec *Spec) {
+		spec.SamplerType = SamplerRule
+		spec.SamplerRules = []string{"POST /checkout=1", "/healthz=0", "/*=0"}
+		spec.SampleRate = 0
+	})
+
+	sampled := z.sampleRequest(httptest.NewRequest("POST", "/checkout", nil))
+	assert.True(t, *sampled)
+	sampled = z.sampleRequest(httptest.NewRequest("GET", "/healthz", nil))
+	assert.False(t, *sampled)
+
+	// The first matched rule wins, and the unmatched requests are left to the tracer.
+	sampled = z.sampleRequest(httptest.NewRequest("GET", "/checkout", nil))
+	assert.False(t, *sampled)
+	assert.Nil(t, z.sampleRequest(httptest.NewRequest("GET", "/api/orders", nil)))
+	assert.False(t, z.sample(1))
+
+	// The paths of agent config win over the rules.
+	assert.Nil(t, z.ApplyAgentConfig(map[string]string{"tracing.sample.paths": "/healthz=1"}))
+	sampled = z.sampleRequest(httptest.NewRequest("GET", "/healthz", nil))
+	assert.True(t, *sampled)
+
+	// The rules decide from the trace id carried by the request.
+	z = newSamplerZipkin(t, func(spec *Spec) {
+		spec.SamplerType = SamplerRule
+		spec.SamplerRules = []string{"/api/*=0.5"}
+		spec.SampleOverrideUpstream = true
+	})
+	for _, traceID := range []string{"0000000000000001", "ffffffffffffffff", "80f198ee56343ba864fe8b2a57d3eff7"} {
+		req := httptest.NewRequest("GET", "/api/orders", nil)
+		req.Header.Set("X-B3-TraceId", traceID)
+		req.Header.Set("X-B3-SpanId", "e457b5a2e4d86bd1")
+		expected := *z.sampleRequest(req)
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, expected, *z.sampleRequest(req), traceID)
+		}
+	}
+	req := httptest.NewRequest("GET", "/api/orders", nil)
+	req.Header.Set("b3", "0000000000000001-e457b5a2e4d86bd1")
+	assert.True(t, *z.sampleRequest(req))
+	req.Header.Set("b3", "ffffffffffffffff-e457b5a2e4d86bd1")
+	assert.False(t, *z.sampleRequest(req))
+
+	// The rules are only used by the rule sampler.
+	z = newSamplerZipkin(t, func(spec *Spec) {
+		spec.SamplerRules = []string{"/healthz=0"}
+	})
+	assert.Nil(t, z.sampleRequest(httptest.NewRequest("GET", "/healthz", nil)))
+}
+
+func TestUpstreamDecisionFormats(t *testing.T) {
+	z := newSamplerZipkin(t, func(spec *Spec) {})
+	assert.Nil(t, z.ApplyAgentConfig(map[string]string{"tracing.sample.paths": "/api/*=0"}))
+
+	// The root requests follow the paths.
+	sampled := z.sampleRequest(httptest.NewRequest("GET", "/api/orders", nil))
+	assert.False(t, *sampled)
+
+	for _, headers := range []map[string]string{
+		{"X-B3-Sampled": "1"},
+		{"X-B3-Flags": "1"},
+		{"b3": "1"},
+		{"b3": "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1"},
+	} {
+		req := httptest.NewRequest("GET", "/api/orders", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		assert.Nil(t, z.sampleRequest(req), headers)
+	}
+
+	// The single header without sampling state carries no decision.
+	req := httptest.NewRequest("GET", "/api/orders", nil)
+	req.Header.Set("b3", "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1")
+	sampled = z.sampleRequest(req)
+	assert.False(t, *sampled)
+
+	// The decisions of upstream are kept even if tracing is disabled.
+	assert.Nil(t, z.ApplyAgentConfig(map[string]string{"tracing.enable": "false"}))
+	req = httptest.NewRequest("GET", "/api/orders", nil)
+	req.Header.Set("X-B3-Sampled", "1")
+	assert.Nil(t, z.sampleRequest(req))
+}
@@ -18,8 +18,12 @@ package zipkin
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/megaease/easeagent-sdk-go/plugins"
+	"github.com/openzipkin/zipkin-go/reporter"
+	"golang.org/x/exp/slices"
 )
 
 const (
@@ -34,26 +38,58 @@ type (
 	Spec struct {
 		plugins.BaseSpec `json:",inline"`
 
-		OutputServerURL string `json:"reporter.output.server"`
+		OutputServerURL string `json:"reporter.output.server" jsonschema_description:"the url of the output server receiving spans, empty value reports spans to log"`
 
-		EnableTLS bool   `json:"reporter.output.server.tls.enable"`
-		TLSKey    string `json:"reporter.output.server.tls.key"`
-		TLSCert   string `json:"reporter.output.server.tls.cert"`
-		TLSCaCert string `json:"reporter.output.server.tls.caCert"`
+		EnableTLS bool   `json:"reporter.output.server.tls.enable" jsonschema_description:"whether the output server uses tls"`
+		TLSKey    string `json:"reporter.output.server.tls.key" jsonschema_description:"the tls key of the output server in PEM"`
+		TLSCert   string `json:"reporter.output.server.tls.cert" jsonschema_description:"the tls cert of the output server in PEM"`
+		TLSCaCert string `json:"reporter.output.server.tls.caCert" jsonschema_description:"the tls ca cert of the output server in PEM"`
 
-		EnableBasicAuth bool   `json:"reporter.output.server.auth.enable"`
-		Username        string `json:"reporter.output.server.auth.username"`
-		Password        string `json:"reporter.output.server.auth.password"`
+		EnableBasicAuth bool   `json:"reporter.output.server.auth.enable" jsonschema_description:"whether the output server uses basic auth"`
+		Username        string `json:"reporter.output.server.auth.username" jsonschema_description:"the basic auth username of the output server"`
+		Password        string `json:"reporter.output.server.auth.password" jsonschema_description:"the basic auth password of the output server"`
 
-		ServiceName   string            `json:"serviceName"`
-		TracingType   string            `json:"tracing.type"`
+		ServiceName   string            `json:"serviceName" jsonschema_description:"the service name of spans"`
+		TracingType   string            `json:"tracing.type" jsonschema_description:"the type of tracing"`
 		LocalHostport string            `json:"-"`
 		Tags          map[string]string `json:"-"`
 
-		EnableTracing bool    `json:"tracing.enable" jsonschema:"required,minimum=0,maximum=1"`
-		SampleRate    float64 `json:"tracing.sample.rate" jsonschema:"required,minimum=0,maximum=1"`
-		SharedSpans   bool    `json:"tracing.shared.spans"`
-		ID128Bit      bool    `json:"tracing.id128bit"`
+		// Reporter overrides the reporter built from OutputServerURL,
+		// it's useful for custom transports and tests.
+		Reporter reporter.Reporter `json:"-"`
+
+		// NOTE: The keys are not required in agent.yml, which fall back to the defaults.
+		EnableTracing bool    `json:"tracing.enable" jsonschema_description:"the tracing switch"`
+		SampleRate    float64 `json:"tracing.sample.rate" jsonschema:"minimum=0,maximum=1" jsonschema_description:"the tracing sample rate"`
+		SharedSpans   bool    `json:"tracing.shared.spans" jsonschema_description:"whether the client and server spans share the same span id"`
+		ID128Bit      bool    `json:"tracing.id128bit" jsonschema_description:"whether the trace id uses 128 bits"`
+
+		SampleOverrideUpstream bool `json:"tracing.sample.overrideUpstream" jsonschema_description:"whether tracing.enable and the sample paths and rules override the decisions of upstream"`
+
+		SamplerType            string   `json:"tracing.sampler.type" jsonschema:"enum=boundary,enum=rateLimiting,enum=rule" jsonschema_description:"the sampler of traces"`
+		SamplerTracesPerSecond float64  `json:"tracing.sampler.tracesPerSecond" jsonschema:"minimum=0" jsonschema_description:"the max traces per second sampled by the rateLimiting sampler"`
+		SamplerRules           []string `json:"tracing.sampler.rules" jsonschema_description:"the sample rates of requests in the form of [METHOD ]glob=rate matched in order, used by the rule sampler"`
+
+		TailSamplingEnable           bool              `json:"tracing.tailSampling.enable" jsonschema_description:"whether to buffer the local spans of traces and keep the error, slow and matched ones"`
+		TailSamplingBaseRate         float64           `json:"tracing.tailSampling.baseRate" jsonschema:"minimum=0,maximum=1" jsonschema_description:"the sample rate of the other traces"`
+		TailSamplingLatencyThreshold string            `json:"tracing.tailSampling.latencyThreshold" jsonschema_description:"the traces having a span not shorter than it are kept, such as 500ms, empty value disables it"`
+		TailSamplingTags             map[string]string `json:"tracing.tailSampling.tags" jsonschema_description:"the traces having a span with any of the tags are kept, empty value matches any value"`
+		TailSamplingMaxTraces        int               `json:"tracing.tailSampling.maxTraces" jsonschema:"minimum=1" jsonschema_description:"the max count of buffered traces, the oldest one is decided if exceeded"`
+		TailSamplingMaxSpansPerTrace int               `json:"tracing.tailSampling.maxSpansPerTrace" jsonschema:"minimum=1" jsonschema_description:"the max count of buffered spans of a trace, the others are dropped"`
+		TailSamplingTraceTimeout     string            `json:"tracing.tailSampling.traceTimeout" jsonschema_description:"the traces are decided if their local root spans don't finish in it, such as 30s, empty value means no timeout"`
+
+		ProcessorsDropNames         []string          `json:"tracing.processors.dropNames" jsonschema_description:"the spans whose names match any of the patterns are dropped, * matches any characters"`
+		ProcessorsRenames           map[string]string `json:"tracing.processors.renames" jsonschema_description:"the spans are renamed from the keys to the values"`
+		ProcessorsTags              map[string]string `json:"tracing.processors.tags" jsonschema_description:"the static tags added to spans, the tags set by spans are not overridden"`
+		ProcessorsMaxTagValueLength int               `json:"tracing.processors.maxTagValueLength" jsonschema:"minimum=0" jsonschema_description:"the max bytes of tag values, the longer ones are truncated, 0 means no limit"`
+
+		Propagation []string `json:"tracing.propagation" jsonschema_description:"the propagation formats among b3, b3single and w3c, extracted in order and all injected"`
+
+		BaggageKeys         []string `json:"tracing.baggage.keys" jsonschema_description:"the allowlist of baggage keys, empty value disables baggage"`
+		BaggageTagKeys      []string `json:"tracing.baggage.tagKeys" jsonschema_description:"the baggage keys copied onto spans as tags baggage.{key}"`
+		BaggageHeaderPrefix string   `json:"tracing.baggage.headerPrefix" jsonschema_description:"the header prefix of baggage keys such as baggage-, empty value uses the W3C baggage header"`
+		BaggageMaxEntries   int      `json:"tracing.baggage.maxEntries" jsonschema:"minimum=0" jsonschema_description:"the max count of baggage entries, zero value means 64"`
+		BaggageMaxBytes     int      `json:"tracing.baggage.maxBytes" jsonschema:"minimum=0" jsonschema_description:"the max encoded bytes of baggage, zero value means 8192"`
 	}
 )
 
@@ -76,10 +112,23 @@ func DefaultSpec() plugins.Spec {
 		LocalHostport: "127.0.0.1:80",
 
 		SampleRate:  1,
+		SamplerType: SamplerBoundary,
 		SharedSpans: true,
 		ID128Bit:    false,
 		Username:    "",
 		Password:    "",
+
+		TailSamplingEnable:           false,
+		TailSamplingBaseRate:         0.1,
+		TailSamplingLatencyThreshold: "1s",
+		TailSamplingMaxTraces:        1000,
+		TailSamplingMaxSpansPerTrace: 256,
+		TailSamplingTraceTimeout:     "30s",
+
+		Propagation: []string{PropagationB3},
+
+		BaggageMaxEntries: defaultBaggageMaxEntries,
+		BaggageMaxBytes:   defaultBaggageMaxBytes,
 	}
 }
 
@@ -91,19 +140,54 @@ func NewConsoleReportSpec(localHostPort string) Spec {
 	return spec
 }
 
-// Validate validates the Zipkin spec.
+// Validate validates the Zipkin spec, it reports all problems together.
 func (spec Spec) Validate() error {
+	var msgs []string
+
+	if err := plugins.ValidateSchema(spec); err != nil {
+		msgs = append(msgs, err.Error())
+	}
+
+	if spec.OutputServerURL != "" {
+		u, err := url.Parse(spec.OutputServerURL)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("invalid reporter.output.server %q: %v", spec.OutputServerURL, err))
+		} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			msgs = append(msgs, fmt.Sprintf("invalid reporter.output.server %q: want http(s)://host[:port]/path", spec.OutputServerURL))
+		}
+	}
+
 	if spec.EnableTLS {
 		if len(spec.TLSKey) == 0 || len(spec.TLSCert) == 0 || len(spec.TLSCaCert) == 0 {
-			return fmt.Errorf("key, cert, cacert are not all specified")
+			msgs = append(msgs, "key, cert, cacert are not all specified")
+		} else if _, err := newTLSConfig([]byte(spec.TLSCert), []byte(spec.TLSKey), []byte(spec.TLSCaCert)); err != nil {
+			msgs = append(msgs, fmt.Sprintf("invalid tls material: %v", err))
 		}
 	}
 
 	if spec.EnableBasicAuth {
 		if spec.Username == "" || spec.Password == "" {
-			return fmt.Errorf("username and password are not all specified")
+			msgs = append(msgs, "username and password are not all specified")
 		}
 	}
 
+	msgs = append(msgs, validateSampler(spec)...)
+	msgs = append(msgs, validateTailSampling(spec)...)
+	msgs = append(msgs, validateBaggage(spec)...)
+
+	if _, err := newSpanProcessors(spec); err != nil {
+		msgs = append(msgs, err.Error())
+	}
+
+	for _, format := range spec.Propagation {
+		if !slices.Contains(propagationFormats, format) {
+			msgs = append(msgs, fmt.Sprintf("invalid tracing.propagation %q: want one of %s", format, strings.Join(propagationFormats, ", ")))
+		}
+	}
+
+	if len(msgs) != 0 {
+		return fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+
 	return nil
 }
@@ -64,6 +64,21 @@ func TestYamlToSpac(t *testing.T) {
 	assert.Equal(t, "test_password", spec.Password)
 }
 
+func TestValidate(t *testing.T) {
+	spec := DefaultSpec().(Spec)
+	assert.Nil(t, spec.Validate())
+
+	spec.SampleRate = -0.1
+	spec.OutputServerURL = "localhost:9411"
+	spec.EnableTLS = true
+	spec.TLSKey, spec.TLSCert, spec.TLSCaCert = "key", "cert", "ca"
+	spec.EnableBasicAuth = true
+	assert.EqualError(t, spec.Validate(), "tracing.sample.rate -0.1 is out of range [0, 1]; "+
+		`invalid reporter.output.server "localhost:9411": want http(s)://host[:port]/path; `+
+		"invalid tls material: load client cert failed: tls: failed to find any PEM data in certificate input; "+
+		"username and password are not all specified")
+}
+
 func getYaml() string {
 	return `service_name: demo.go.test-service
 tracing_type: log-tracing
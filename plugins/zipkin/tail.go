@@ -0,0 +1,462 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zipkin
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	zipkingo "github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/reporter"
+)
+
+const (
+	// errorTagKey is the tag of the failed spans set by zipkin-go.
+	errorTagKey = "error"
+
+	// The reasons of keeping traces.
+	tailReasonError   = "error"
+	tailReasonLatency = "latency"
+	tailReasonTags    = "tags"
+	tailReasonBase    = "base"
+
+	// minTailExpireInterval is the min interval of deciding the traces timing out.
+	minTailExpireInterval = 10 * time.Millisecond
+)
+
+type (
+	// TailSamplingStats is the counters of the tail sampler.
+	TailSamplingStats struct {
+		// Buffered is the count of the traces waiting for their local root spans.
+		Buffered int `json:"buffered"`
+		// Kept is the count of the kept traces by the reasons: error, latency, tags and base.
+		Kept map[string]uint64 `json:"kept"`
+		// Dropped is the count of the dropped traces.
+		Dropped uint64 `json:"dropped"`
+		// Evicted is the count of the traces decided before their local root spans finish,
+		// because the buffer is full or they time out.
+		Evicted uint64 `json:"evicted"`
+		// DroppedSpans is the count of the spans dropped because their traces exceed
+		// the max spans per trace.
+		DroppedSpans uint64 `json:"droppedSpans"`
+	}
+
+	// tailPolicy is the settings of the tail sampler.
+	tailPolicy struct {
+		baseSampler      zipkingo.Sampler
+		latencyThreshold time.Duration
+		tags             map[string]string
+		maxTraces        int
+		maxSpans         int
+		traceTimeout     time.Duration
+	}
+
+	// tailSampler buffers the local spans of traces until their local root spans finish,
+	// then sends the kept traces to the next reporter. The decisions are remembered for
+	// the spans finishing after the local root spans, such as the ones of async tasks.
+	tailSampler struct {
+		next reporter.Reporter
+		now  func() time.Time
+
+		mutex  sync.Mutex
+		policy *tailPolicy // nil means all spans pass through
+		// traces are the buffered traces in the order of their first spans.
+		traces  *list.List // type: *tailTrace
+		buffers map[model.TraceID]*list.Element
+		// decided are the recent decisions in order.
+		decided   *list.List // type: model.TraceID
+		decisions map[model.TraceID]bool
+		stats     TailSamplingStats
+		// stopExpire stops the goroutine deciding the traces timing out.
+		stopExpire chan struct{}
+	}
+
+	tailTrace struct {
+		id    model.TraceID
+		start time.Time
+		// root is the first local root span started in the trace,
+		// nil means the trace is decided by the first server span or root span.
+		root  *model.ID
+		spans []model.SpanModel
+	}
+)
+
+var _ reporter.Reporter = (*tailSampler)(nil)
+
+// newTailPolicy returns the tail sampling policy of spec, it returns nil if tail sampling is disabled.
+func newTailPolicy(spec Spec) (*tailPolicy, error) {
+	if !spec.TailSamplingEnable {
+		return nil, nil
+	}
+
+	baseSampler, err := zipkingo.NewBoundarySampler(spec.TailSamplingBaseRate, time.Now().Unix())
+	if err != nil {
+		return nil, fmt.Errorf("new tail base sampler failed: %v", err)
+	}
+
+	return &tailPolicy{
+		baseSampler:      baseSampler,
+		latencyThreshold: parseDuration(spec.TailSamplingLatencyThreshold),
+		tags:             spec.TailSamplingTags,
+		maxTraces:        spec.TailSamplingMaxTraces,
+		maxSpans:         spec.TailSamplingMaxSpansPerTrace,
+		traceTimeout:     parseDuration(spec.TailSamplingTraceTimeout),
+	}, nil
+}
+
+// validateTailSampling validates the tail sampling settings of spec.
+func validateTailSampling(spec Spec) []string {
+	var msgs []string
+	durations := []struct {
+		key   string
+		value string
+	}{
+		{"tracing.tailSampling.latencyThreshold", spec.TailSamplingLatencyThreshold},
+		{"tracing.tailSampling.traceTimeout", spec.TailSamplingTraceTimeout},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(d.value); err != nil || duration < 0 {
+			msgs = append(msgs, fmt.Sprintf("invalid %s %q: want duration such as 500ms", d.key, d.value))
+		}
+	}
+
+	return msgs
+}
+
+// parseDuration parses the validated duration, empty value means zero.
+func parseDuration(value string) time.Duration {
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+func newTailSampler(next reporter.Reporter) *tailSampler {
+	return &tailSampler{
+		next:      next,
+		now:       time.Now,
+		traces:    list.New(),
+		buffers:   map[model.TraceID]*list.Element{},
+		decided:   list.New(),
+		decisions: map[model.TraceID]bool{},
+		stats:     TailSamplingStats{Kept: map[string]uint64{}},
+	}
+}
+
+// setPolicy sets the policy, the buffered traces are decided by the old policy
+// if tail sampling is disabled. The traces timing out are decided periodically.
+func (t *tailSampler) setPolicy(policy *tailPolicy) {
+	t.mutex.Lock()
+	var spans []model.SpanModel
+	if policy == nil && t.policy != nil {
+		spans = t.flush()
+	}
+	t.policy = policy
+
+	t.stopExpireLocked()
+	if policy != nil && policy.traceTimeout > 0 {
+		interval := policy.traceTimeout / 4
+		if interval < minTailExpireInterval {
+			interval = minTailExpireInterval
+		}
+		t.stopExpire = make(chan struct{})
+		go t.runExpire(interval, t.stopExpire)
+	}
+	t.mutex.Unlock()
+
+	t.send(spans)
+}
+
+// runExpire decides the traces timing out every interval until stop is closed.
+func (t *tailSampler) runExpire(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.mutex.Lock()
+			var spans []model.SpanModel
+			if t.policy != nil {
+				spans = t.expire()
+			}
+			t.mutex.Unlock()
+
+			t.send(spans)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (t *tailSampler) stopExpireLocked() {
+	if t.stopExpire != nil {
+		close(t.stopExpire)
+		t.stopExpire = nil
+	}
+}
+
+// begin records the span as the local root span of its trace if the trace has none,
+// so the trace is decided when the span finishes, not by the nested server spans.
+func (t *tailSampler) begin(span zipkingo.Span) {
+	if span == nil || zipkingo.IsNoop(span) {
+		return
+	}
+	sc := span.Context()
+
+	t.mutex.Lock()
+	if t.policy == nil {
+		t.mutex.Unlock()
+		return
+	}
+	if _, decided := t.decisions[sc.TraceID]; decided {
+		t.mutex.Unlock()
+		return
+	}
+
+	var spans []model.SpanModel
+	elem, exists := t.buffers[sc.TraceID]
+	if !exists {
+		elem, spans = t.push(sc.TraceID)
+	}
+	if trace := elem.Value.(*tailTrace); trace.root == nil {
+		id := sc.ID
+		trace.root = &id
+	}
+	t.mutex.Unlock()
+
+	t.send(spans)
+}
+
+// Send buffers the span until the local root span of its trace finishes.
+func (t *tailSampler) Send(s model.SpanModel) {
+	t.mutex.Lock()
+	if t.policy == nil {
+		t.mutex.Unlock()
+		t.next.Send(s)
+		return
+	}
+
+	spans := t.expire()
+	spans = append(spans, t.add(s)...)
+	t.mutex.Unlock()
+
+	t.send(spans)
+}
+
+// add adds the span and returns the spans to send.
+func (t *tailSampler) add(s model.SpanModel) []model.SpanModel {
+	if keep, decided := t.decisions[s.TraceID]; decided {
+		if keep {
+			return []model.SpanModel{s}
+		}
+		return nil
+	}
+
+	elem, exists := t.buffers[s.TraceID]
+	if !exists {
+		var spans []model.SpanModel
+		elem, spans = t.push(s.TraceID)
+		return append(spans, t.append(elem, s)...)
+	}
+
+	return t.append(elem, s)
+}
+
+// push buffers the new trace, and returns the spans of the oldest trace to send
+// if the buffer is full.
+func (t *tailSampler) push(id model.TraceID) (*list.Element, []model.SpanModel) {
+	var spans []model.SpanModel
+	if t.traces.Len() >= t.policy.maxTraces {
+		t.stats.Evicted++
+		spans = t.decide(t.traces.Front())
+	}
+	elem := t.traces.PushBack(&tailTrace{id: id, start: t.now()})
+	t.buffers[id] = elem
+
+	return elem, spans
+}
+
+func (t *tailSampler) append(elem *list.Element, s model.SpanModel) []model.SpanModel {
+	trace := elem.Value.(*tailTrace)
+	if len(trace.spans) < t.policy.maxSpans {
+		trace.spans = append(trace.spans, s)
+	} else {
+		t.stats.DroppedSpans++
+	}
+
+	if isLocalRoot(trace, s) {
+		return t.decide(elem)
+	}
+
+	return nil
+}
+
+// isLocalRoot returns true if the span is the local root span of the trace, which is
+// the recorded one, otherwise the server span or the one without parent.
+func isLocalRoot(trace *tailTrace, s model.SpanModel) bool {
+	if trace.root != nil {
+		return s.ID == *trace.root
+	}
+
+	return s.Kind == model.Server || s.ParentID == nil
+}
+
+// drop is called with the span dropped by the span processors, the trace is decided
+// without it if it's the local root span, so the trace doesn't wait for timing out.
+func (t *tailSampler) drop(s model.SpanModel) {
+	t.mutex.Lock()
+	if t.policy == nil {
+		t.mutex.Unlock()
+		return
+	}
+
+	var spans []model.SpanModel
+	if elem, exists := t.buffers[s.TraceID]; exists && isLocalRoot(elem.Value.(*tailTrace), s) {
+		spans = t.decide(elem)
+	}
+	t.mutex.Unlock()
+
+	t.send(spans)
+}
+
+// expire decides the traces timing out, and returns the spans to send.
+func (t *tailSampler) expire() []model.SpanModel {
+	if t.policy.traceTimeout <= 0 {
+		return nil
+	}
+
+	var spans []model.SpanModel
+	now := t.now()
+	for elem := t.traces.Front(); elem != nil; elem = t.traces.Front() {
+		if now.Sub(elem.Value.(*tailTrace).start) < t.policy.traceTimeout {
+			break
+		}
+		t.stats.Evicted++
+		spans = append(spans, t.decide(elem)...)
+	}
+
+	return spans
+}
+
+// flush decides all buffered traces, and returns the spans to send.
+func (t *tailSampler) flush() []model.SpanModel {
+	var spans []model.SpanModel
+	for elem := t.traces.Front(); elem != nil; elem = t.traces.Front() {
+		spans = append(spans, t.decide(elem)...)
+	}
+
+	return spans
+}
+
+// decide removes the buffered trace and remembers the decision,
+// it returns the spans of the trace if it's kept.
+func (t *tailSampler) decide(elem *list.Element) []model.SpanModel {
+	trace := t.traces.Remove(elem).(*tailTrace)
+	delete(t.buffers, trace.id)
+
+	reason := t.policy.reason(trace)
+	keep := reason != ""
+	if keep {
+		t.stats.Kept[reason]++
+	} else {
+		t.stats.Dropped++
+	}
+
+	if t.decided.Len() >= t.policy.maxTraces {
+		delete(t.decisions, t.decided.Remove(t.decided.Front()).(model.TraceID))
+	}
+	t.decided.PushBack(trace.id)
+	t.decisions[trace.id] = keep
+
+	if keep {
+		return trace.spans
+	}
+
+	return nil
+}
+
+// reason returns the reason of keeping the trace, empty value means dropping it.
+func (p *tailPolicy) reason(trace *tailTrace) string {
+	for _, span := range trace.spans {
+		if _, exists := span.Tags[errorTagKey]; exists {
+			return tailReasonError
+		}
+	}
+
+	if p.latencyThreshold > 0 {
+		for _, span := range trace.spans {
+			if span.Duration >= p.latencyThreshold {
+				return tailReasonLatency
+			}
+		}
+	}
+
+	for _, span := range trace.spans {
+		for key, value := range p.tags {
+			if v, exists := span.Tags[key]; exists && (value == "" || v == value) {
+				return tailReasonTags
+			}
+		}
+	}
+
+	if p.baseSampler(trace.id.Low) {
+		return tailReasonBase
+	}
+
+	return ""
+}
+
+func (t *tailSampler) send(spans []model.SpanModel) {
+	for _, s := range spans {
+		t.next.Send(s)
+	}
+}
+
+// snapshot returns the copy of the counters.
+func (t *tailSampler) snapshot() TailSamplingStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	stats := t.stats
+	stats.Buffered = t.traces.Len()
+	stats.Kept = make(map[string]uint64, len(t.stats.Kept))
+	for reason, count := range t.stats.Kept {
+		stats.Kept[reason] = count
+	}
+
+	return stats
+}
+
+// Close decides the buffered traces, and closes the next reporter.
+func (t *tailSampler) Close() error {
+	t.mutex.Lock()
+	t.stopExpireLocked()
+	var spans []model.SpanModel
+	if t.policy != nil {
+		spans = t.flush()
+	}
+	t.mutex.Unlock()
+
+	t.send(spans)
+
+	return t.next.Close()
+}
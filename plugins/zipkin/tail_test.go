@@ -0,0 +1,228 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zipkin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	zipkingo "github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTailSampler(rep *memReporter, update func(spec *Spec)) *tailSampler {
+	spec := newTestSpec(rep)
+	spec.TailSamplingEnable = true
+	spec.TailSamplingBaseRate = 0
+	spec.TailSamplingTags = map[string]string{"http.path": "/checkout", "vip": ""}
+	if update != nil {
+		update(&spec)
+	}
+
+	policy, err := newTailPolicy(spec)
+	if err != nil {
+		panic(err)
+	}
+
+	t := newTailSampler(rep)
+	t.setPolicy(policy)
+	return t
+}
+
+func newTailSpan(traceID uint64, id uint64, parentID uint64, tags map[string]string) model.SpanModel {
+	s := model.SpanModel{
+		SpanContext: model.SpanContext{TraceID: model.TraceID{Low: traceID}, ID: model.ID(id)},
+		Kind:        model.Client,
+		Tags:        tags,
+	}
+	if parentID != 0 {
+		parent := model.ID(parentID)
+		s.ParentID = &parent
+	}
+	return s
+}
+
+func (r *memReporter) traceIDs() []uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ids := []uint64{}
+	for _, s := range r.spans {
+		ids = append(ids, s.TraceID.Low)
+	}
+	return ids
+}
+
+func TestTailSamplingDecisions(t *testing.T) {
+	rep := &memReporter{}
+	tail := newTestTailSampler(rep, nil)
+
+	// The error of a child span keeps the trace after the root span finishes.
+	tail.Send(newTailSpan(1, 2, 1, map[string]string{"error": "500"}))
+	assert.Empty(t, rep.traceIDs())
+	tail.Send(newTailSpan(1, 1, 0, nil))
+	assert.Equal(t, []uint64{1, 1}, rep.traceIDs())
+
+	// The late spans follow the decision.
+	tail.Send(newTailSpan(1, 3, 1, nil))
+	assert.Equal(t, []uint64{1, 1, 1}, rep.traceIDs())
+
+	// The trace without errors is dropped at base rate 0, so are its late spans.
+	tail.Send(newTailSpan(2, 2, 1, nil))
+	tail.Send(newTailSpan(2, 1, 0, nil))
+	tail.Send(newTailSpan(2, 3, 1, map[string]string{"error": "late"}))
+	assert.Equal(t, []uint64{1, 1, 1}, rep.traceIDs())
+
+	// The slow trace.
+	slow := newTailSpan(3, 1, 0, nil)
+	slow.Duration = 2 * time.Second
+	tail.Send(slow)
+
+	// The server span is the local root even if it has a parent upstream.
+	matched := newTailSpan(4, 2, 1, map[string]string{"http.path": "/checkout"})
+	matched.Kind = model.Server
+	tail.Send(matched)
+	tail.Send(newTailSpan(5, 1, 0, map[string]string{"http.path": "/orders"}))
+	tail.Send(newTailSpan(6, 1, 0, map[string]string{"vip": "gold"}))
+	assert.Equal(t, []uint64{1, 1, 1, 3, 4, 6}, rep.traceIDs())
+
+	assert.Equal(t, TailSamplingStats{
+		Kept:    map[string]uint64{"error": 1, "latency": 1, "tags": 2},
+		Dropped: 2,
+	}, tail.snapshot())
+}
+
+func TestTailSamplingBounds(t *testing.T) {
+	now := time.Unix(0, 0)
+	rep := &memReporter{}
+	tail := newTestTailSampler(rep, func(spec *Spec) {
+		spec.TailSamplingMaxTraces = 2
+		spec.TailSamplingMaxSpansPerTrace = 2
+		spec.TailSamplingTraceTimeout = "10s"
+	})
+	tail.now = func() time.Time { return now }
+
+	// The spans exceeding the max spans per trace are dropped.
+	tail.Send(newTailSpan(1, 2, 1, map[string]string{"error": "500"}))
+	tail.Send(newTailSpan(1, 3, 1, nil))
+	tail.Send(newTailSpan(1, 4, 1, nil))
+	assert.Equal(t, uint64(1), tail.snapshot().DroppedSpans)
+
+	// The oldest trace is decided when the buffer is full.
+	tail.Send(newTailSpan(2, 2, 1, nil))
+	assert.Equal(t, 2, tail.snapshot().Buffered)
+	tail.Send(newTailSpan(3, 2, 1, nil))
+	assert.Equal(t, []uint64{1, 1}, rep.traceIDs())
+	assert.Equal(t, uint64(1), tail.snapshot().Evicted)
+
+	// The traces timing out are decided.
+	now = now.Add(10 * time.Second)
+	tail.Send(newTailSpan(4, 2, 1, map[string]string{"error": "500"}))
+	stats := tail.snapshot()
+	assert.Equal(t, uint64(3), stats.Evicted)
+	assert.Equal(t, uint64(2), stats.Dropped)
+	assert.Equal(t, 1, stats.Buffered)
+
+	// The buffered traces are decided when closing.
+	assert.Nil(t, tail.Close())
+	assert.Equal(t, []uint64{1, 1, 4}, rep.traceIDs())
+	assert.True(t, rep.closed)
+}
+
+func TestTailSamplingZipkin(t *testing.T) {
+	rep := &memReporter{}
+	spec := newTestSpec(rep)
+	spec.TailSamplingEnable = true
+	spec.TailSamplingBaseRate = 0
+	assert.Nil(t, spec.Validate())
+
+	plug, err := New(spec)
+	assert.Nil(t, err)
+	z := plug.(*Zipkin)
+
+	handler := z.WrapUserHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span, _ := z.StartSpanFromCtx(r.Context(), "query")
+		span.Finish()
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/ok", nil))
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+	assert.Len(t, rep.traceIDs(), 2, "only the spans of the failed request are kept")
+
+	w := httptest.NewRecorder()
+	assert.True(t, z.HandleAgentRequest(w, httptest.NewRequest("GET", "/tail-sampling", nil)))
+	stats := TailSamplingStats{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, uint64(1), stats.Kept["error"])
+	assert.Equal(t, uint64(1), stats.Dropped)
+
+	// Disabling tail sampling decides the buffered traces and passes spans through.
+	span := z.StartSpan(nil, "root")
+	z.StartSpan(span, "child").Finish()
+	spec.TailSamplingEnable = false
+	assert.Nil(t, z.Reload(spec))
+	span.Finish()
+	assert.Len(t, rep.traceIDs(), 3)
+
+	spec.TailSamplingTraceTimeout = "soon"
+	assert.Contains(t, spec.Validate().Error(), "tracing.tailSampling.traceTimeout")
+}
+
+func TestTailSamplingLocalRoot(t *testing.T) {
+	rep := &memReporter{}
+	spec := newTestSpec(rep)
+	spec.SampleRate = 0
+	spec.TailSamplingEnable = true
+	spec.TailSamplingBaseRate = 0
+	spec.TailSamplingTraceTimeout = "20ms"
+
+	plug, err := New(spec)
+	assert.Nil(t, err)
+	z := plug.(*Zipkin)
+	defer z.Close()
+
+	// The head sampler records everything, and the base rate applies at the tail.
+	assert.True(t, z.sample(1))
+
+	// The nested server span doesn't decide the trace started by the local root span.
+	root := z.StartSpan(nil, "root")
+	client := z.StartSpan(root, "client", zipkingo.Kind(model.Client))
+	nested := z.StartSpan(client, "nested", zipkingo.Kind(model.Server))
+	nested.Tag("error", "500")
+	nested.Finish()
+	client.Finish()
+	assert.Empty(t, rep.traceIDs())
+	assert.Equal(t, 1, z.TailSamplingStats().Buffered)
+	root.Finish()
+	assert.Len(t, rep.traceIDs(), 3)
+
+	// The traces timing out are decided without new spans.
+	root = z.StartSpan(nil, "root")
+	child := z.StartSpan(root, "child")
+	child.Tag("error", "500")
+	child.Finish()
+	assert.Eventually(t, func() bool {
+		return len(rep.traceIDs()) == 4
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, uint64(1), z.TailSamplingStats().Evicted)
+}
@@ -18,18 +18,19 @@ package zipkin
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
-	"time"
+	"sync"
+	"sync/atomic"
 
 	"github.com/megaease/easeagent-sdk-go/plugins"
 	"github.com/openzipkin/zipkin-go"
 	zipkingo "github.com/openzipkin/zipkin-go"
 	zipkinhttp "github.com/openzipkin/zipkin-go/middleware/http"
 	"github.com/openzipkin/zipkin-go/model"
-	"github.com/openzipkin/zipkin-go/reporter"
 )
 
 func init() {
@@ -38,6 +39,8 @@ func init() {
 		DefaultSpec:  DefaultSpec,
 		SystemPlugin: false,
 		NewInstance:  New,
+		// NOTE: Load it later than others, so that the server span covers them.
+		Priority: 100,
 	}
 
 	plugins.Register(cons)
@@ -56,57 +59,195 @@ type (
 		StartMWSpan(parent zipkin.Span, name string, mwType MiddlewareType, options ...zipkin.SpanOption) zipkin.Span
 		//start a middleware span from context.Context
 		StartMWSpanFromCtx(parent context.Context, name string, mwType MiddlewareType, options ...zipkin.SpanOption) (zipkin.Span, context.Context)
+		//set a baggage value carried along the call chain by the span in context.Context
+		SetBaggage(ctx context.Context, key, value string) error
+		//get the baggage carried by the span in context.Context
+		Baggage(ctx context.Context) map[string]string
 	}
 
 	// Zipkin is the Zipkin dedicated plugin.
 	Zipkin struct {
-		spec Spec
+		state    atomic.Value // type: *tracingState
+		sampling atomic.Value // type: *sampling
+		reporter *swapReporter
+		// tail is in front of reporter, which passes all spans through unless tail sampling is enabled.
+		tail *tailSampler
+		// processors are in front of tail, which run the span processors,
+		// so the dropped spans don't take the buffer of tail sampling.
+		processors *processingReporter
 
-		reporter reporter.Reporter
-		tracer   *zipkin.Tracer
+		// mutex serializes Reload and ApplyAgentConfig.
+		mutex sync.Mutex
+		// agentConfig is the agent config pushed to the agent endpoint /config,
+		// which overrides the sampling settings of the spec.
+		agentConfig map[string]string
+	}
+
+	// tracingState is the tracer built from the spec.
+	tracingState struct {
+		spec    Spec
+		tracer  *zipkin.Tracer
+		baggage *baggagePolicy // nil means baggage is disabled
 	}
 )
 
 // New creates a new Zipkin plugin.
 func New(pluginSpec plugins.Spec) (plugins.Plugin, error) {
+	reporter := &swapReporter{}
+	tail := newTailSampler(reporter)
+	z := &Zipkin{
+		reporter:    reporter,
+		tail:        tail,
+		processors:  &processingReporter{next: tail, onDrop: tail.drop},
+		agentConfig: map[string]string{},
+	}
+
+	err := z.Reload(pluginSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	return z, nil
+}
+
+// Reload swaps the tracer and the reporter built from the new spec.
+// The spans of the old tracer are sent to the new reporter, so in-flight spans are not dropped.
+// The sampling settings pushed to the agent endpoint /config are kept.
+func (z *Zipkin) Reload(pluginSpec plugins.Spec) error {
 	spec := pluginSpec.(Spec)
 
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+
 	endpoint, err := newLocalEndpoint(spec.ServiceName, spec.LocalHostport)
 	if err != nil {
-		return nil, fmt.Errorf("new endpoint failed: %v", err)
+		return fmt.Errorf("new endpoint failed: %v", err)
 	}
 
-	reporter, err := newReporter(spec)
+	sampling, err := newSampling(spec, z.agentConfig, z.loadSamplingOrNil())
 	if err != nil {
-		return nil, fmt.Errorf("new reporter failed: %v", err)
+		return err
 	}
 
-	sampler := zipkingo.NeverSample
-	if spec.EnableTracing {
-		sampler, err = zipkingo.NewBoundarySampler(spec.SampleRate, time.Now().Unix())
-		if err != nil {
-			return nil, fmt.Errorf("new sampler failed: %v", err)
-		}
+	tailPolicy, err := newTailPolicy(spec)
+	if err != nil {
+		return err
 	}
 
-	tracer, err := zipkin.NewTracer(reporter,
+	processors, err := newSpanProcessors(spec)
+	if err != nil {
+		return err
+	}
+
+	tracer, err := zipkin.NewTracer(z.processors,
 		zipkin.WithLocalEndpoint(endpoint),
 		zipkin.WithTags(spec.Tags),
-		zipkingo.WithSampler(sampler),
+		zipkingo.WithSampler(z.sample),
 		zipkingo.WithSharedSpans(spec.SharedSpans),
 		zipkingo.WithTraceID128Bit(spec.ID128Bit),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("new tracer failed: %v", err)
+		return fmt.Errorf("new tracer failed: %v", err)
 	}
 
-	z := &Zipkin{
-		spec:     spec,
-		tracer:   tracer,
-		reporter: reporter,
+	reporter, err := newReporter(spec)
+	if err != nil {
+		return fmt.Errorf("new reporter failed: %v", err)
 	}
 
-	return z, nil
+	z.processors.setDeclared(processors)
+	z.tail.setPolicy(tailPolicy)
+	z.sampling.Store(sampling)
+	z.state.Store(&tracingState{
+		spec:    spec,
+		tracer:  tracer,
+		baggage: newBaggagePolicy(spec),
+	})
+
+	old := z.reporter.swap(reporter)
+	if old != nil && old != reporter {
+		err := old.Close()
+		if err != nil {
+			log.Printf("close old reporter failed: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (z *Zipkin) load() *tracingState {
+	return z.state.Load().(*tracingState)
+}
+
+func (z *Zipkin) loadSampling() *sampling {
+	return z.sampling.Load().(*sampling)
+}
+
+// loadSamplingOrNil returns nil before the first reloading.
+func (z *Zipkin) loadSamplingOrNil() *sampling {
+	s, _ := z.sampling.Load().(*sampling)
+	return s
+}
+
+// sample is the sampler of tracers, which applies the current sampling settings.
+func (z *Zipkin) sample(id uint64) bool {
+	return z.loadSampling().sample(id)
+}
+
+// sampleRequest applies the sampling settings of paths, please see sampling.sampleRequest.
+func (z *Zipkin) sampleRequest(r *http.Request) *bool {
+	return z.loadSampling().sampleRequest(r)
+}
+
+// ApplyAgentConfig applies tracing.enable, tracing.sample.rate, tracing.sample.paths and
+// tracing.sample.overrideUpstream pushed to the agent endpoint /config live, which override
+// the ones of the spec. The tracing.sample.paths are in the form of "/health=0,/api/*=0.1",
+// the pattern ending with * matches the prefix of paths, and the longest pattern wins.
+// The decisions of upstream are kept unless tracing.sample.overrideUpstream is true.
+func (z *Zipkin) ApplyAgentConfig(config map[string]string) error {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+
+	agentConfig := z.mergeAgentConfig(config)
+	sampling, err := newSampling(z.load().spec, agentConfig, z.loadSampling())
+	if err != nil {
+		return err
+	}
+
+	z.sampling.Store(sampling)
+	z.agentConfig = agentConfig
+
+	return nil
+}
+
+// ValidateAgentConfig validates the agent config without applying it, please see ApplyAgentConfig.
+func (z *Zipkin) ValidateAgentConfig(config map[string]string) error {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+
+	_, err := newSampling(z.load().spec, z.mergeAgentConfig(config), nil)
+	return err
+}
+
+// mergeAgentConfig returns the copy of the current agent config overridden by the sampling keys of config.
+// The caller must hold the mutex.
+func (z *Zipkin) mergeAgentConfig(config map[string]string) map[string]string {
+	agentConfig := map[string]string{}
+	for key, value := range z.agentConfig {
+		agentConfig[key] = value
+	}
+	for _, key := range []string{enableKey, sampleRateKey, samplePathsKey, overrideUpstreamKey} {
+		if value, exists := config[key]; exists {
+			agentConfig[key] = value
+		}
+	}
+
+	return agentConfig
+}
+
+// AgentConfig returns the current effective sampling settings.
+func (z *Zipkin) AgentConfig() map[string]string {
+	return z.loadSampling().config()
 }
 
 func newLocalEndpoint(serviceName string, hostPort string) (*model.Endpoint, error) {
@@ -150,30 +291,94 @@ func NewEndpoint(serviceName string, hostPort string) (*model.Endpoint, error) {
 
 // Name gets the zipkin name
 func (z *Zipkin) Name() string {
-	return z.spec.Name()
+	return z.load().spec.Name()
 }
 
 // Close closes the plugin.
 func (z *Zipkin) Close() error {
-	return z.reporter.Close()
+	return z.processors.Close()
+}
+
+// AddSpanProcessors registers the span processors in code, which run in order after the ones
+// declared in the spec, and are kept across reloading. The processors run before tail sampling,
+// so they see the spans of the traces dropped by it too.
+func (z *Zipkin) AddSpanProcessors(processors ...SpanProcessor) {
+	z.processors.add(processors...)
+}
+
+// TailSamplingStats returns the counters of the tail sampler.
+func (z *Zipkin) TailSamplingStats() TailSamplingStats {
+	return z.tail.snapshot()
+}
+
+// HandleAgentRequest handles the agent request.
+func (z *Zipkin) HandleAgentRequest(w http.ResponseWriter, r *http.Request) bool {
+	switch r.URL.Path {
+	case "/tail-sampling":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(z.TailSamplingStats())
+		return true
+	default:
+		return false
+	}
 }
 
 // WrapUserHandlerFunc wraps the user's http handler.
+// The span context is extracted by the propagation formats in order.
 func (z *Zipkin) WrapUserHandlerFunc(handlerFunc http.HandlerFunc) http.HandlerFunc {
-	handler := zipkinhttp.NewServerMiddleware(
-		z.tracer, zipkinhttp.TagResponseSize(true),
-	)
-	return handler(&HTTPHandlerWrapper{
+	state := z.load()
+	options := []zipkinhttp.ServerOption{
+		zipkinhttp.TagResponseSize(true),
+		zipkinhttp.RequestSampler(z.sampleRequest),
+	}
+
+	// The server span is the local root span of the trace unless it is nested.
+	inner := handlerFunc
+	handlerFunc = func(w http.ResponseWriter, r *http.Request) {
+		z.tail.begin(zipkin.SpanFromContext(r.Context()))
+		inner(w, r)
+	}
+
+	if state.baggage != nil {
+		options = append(options, zipkinhttp.EnableBaggage(state.baggage))
+		next := handlerFunc
+		handlerFunc = func(w http.ResponseWriter, r *http.Request) {
+			z.tagBaggage(zipkin.SpanFromContext(r.Context()))
+			next(w, r)
+		}
+	}
+
+	handler := zipkinhttp.NewServerMiddleware(state.tracer, options...)(&HTTPHandlerWrapper{
 		handlerFunc: handlerFunc,
-	}).ServeHTTP
+	})
+
+	formats := state.spec.Propagation
+	if isDefaultPropagation(formats) {
+		return handler.ServeHTTP
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, extractRequest(formats, r))
+	}
 }
 
-// WrapUserClient wraps the http client.
+// WrapUserClient wraps the http client, the span context is injected in all propagation formats.
 func (z *Zipkin) WrapUserClient(c plugins.HTTPDoer) plugins.HTTPDoer {
 	if original, ok := c.(*http.Client); ok {
-		client, err := zipkinhttp.NewClient(z.tracer,
-			zipkinhttp.WithClient(original),
-			zipkinhttp.ClientTrace(z.spec.EnableTracing),
+		state := z.load()
+
+		// NOTE: zipkinhttp replaces the transport of the client, so it must be a copy.
+		copied := *original
+		if !isDefaultPropagation(state.spec.Propagation) {
+			copied.Transport = &propagationTransport{
+				formats: state.spec.Propagation,
+				base:    original.Transport,
+			}
+		}
+
+		client, err := zipkinhttp.NewClient(state.tracer,
+			zipkinhttp.WithClient(&copied),
+			zipkinhttp.ClientTrace(z.loadSampling().enable),
 		)
 		if err != nil {
 			log.Printf("unable to create client: %+v\n", err)
@@ -191,26 +396,40 @@ func (z *Zipkin) WrapUserClient(c plugins.HTTPDoer) plugins.HTTPDoer {
 func (z *Zipkin) WrapUserClientRequest(current context.Context, req *http.Request) *http.Request {
 	span := zipkin.SpanFromContext(current)
 	ctx := zipkin.NewContext(req.Context(), span)
-	return req.WithContext(ctx)
+	return req.WithContext(withTracestate(ctx, current))
 }
 
 // Tracer gets the zipkin.Tracer
 func (z *Zipkin) Tracer() *zipkin.Tracer {
-	return z.tracer
+	return z.load().tracer
 }
 
 // StartSpan start a Span from parent
 func (z *Zipkin) StartSpan(parent zipkin.Span, name string, options ...zipkin.SpanOption) zipkin.Span {
+	tracer := z.Tracer()
 	if parent == nil {
-		return z.tracer.StartSpan(name, options...)
+		span := tracer.StartSpan(name, z.rootSpanOptions(options)...)
+		z.tail.begin(span)
+		return span
 	}
 	options = append(options, zipkin.Parent(parent.Context()))
-	return z.tracer.StartSpan(name, options...)
+	span := tracer.StartSpan(name, options...)
+	z.tagBaggage(span)
+	return span
 }
 
 // StartSpanFromCtx start a Span from context.Context
 func (z *Zipkin) StartSpanFromCtx(parent context.Context, name string, options ...zipkin.SpanOption) (zipkin.Span, context.Context) {
-	return z.tracer.StartSpanFromContext(parent, name, options...)
+	root := zipkin.SpanFromContext(parent) == nil
+	if root {
+		options = z.rootSpanOptions(options)
+	}
+	span, ctx := z.Tracer().StartSpanFromContext(parent, name, options...)
+	if root {
+		z.tail.begin(span)
+	}
+	z.tagBaggage(span)
+	return span, ctx
 }
 
 // StartMWSpan start a middleware span from parent
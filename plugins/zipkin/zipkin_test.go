@@ -0,0 +1,89 @@
+/**
+ * Copyright 2022 MegaEase
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package zipkin
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// memReporter records spans in memory.
+type memReporter struct {
+	mutex  sync.Mutex
+	spans  []model.SpanModel
+	closed bool
+}
+
+func (r *memReporter) Send(s model.SpanModel) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *memReporter) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.closed = true
+	return nil
+}
+
+func newTestSpec(rep *memReporter) Spec {
+	spec := DefaultSpec().(Spec)
+	spec.LocalHostport = ""
+	spec.Reporter = rep
+	return spec
+}
+
+func TestReload(t *testing.T) {
+	oldReporter, newReporter := &memReporter{}, &memReporter{}
+	plug, err := New(newTestSpec(oldReporter))
+	assert.Nil(t, err)
+	z := plug.(*Zipkin)
+
+	oldTracer := z.Tracer()
+	inflight := z.StartSpan(nil, "inflight")
+
+	spec := newTestSpec(newReporter)
+	spec.ServiceName = "new-service"
+	err = z.Reload(spec)
+	assert.Nil(t, err)
+	assert.NotSame(t, oldTracer, z.Tracer())
+	assert.True(t, oldReporter.closed)
+
+	// The in-flight span of the old tracer is sent to the new reporter.
+	inflight.Finish()
+	z.StartSpan(nil, "new").Finish()
+	assert.Len(t, newReporter.spans, 2)
+	assert.Equal(t, "default-service", newReporter.spans[0].LocalEndpoint.ServiceName)
+	assert.Equal(t, "new-service", newReporter.spans[1].LocalEndpoint.ServiceName)
+
+	// The invalid spec is not applied.
+	spec.SampleRate = 2
+	err = z.Reload(spec)
+	assert.NotNil(t, err)
+	assert.False(t, newReporter.closed)
+
+	assert.Nil(t, z.Close())
+	assert.True(t, newReporter.closed)
+
+	// The spans are dropped after closed.
+	z.StartSpan(nil, "closed").Finish()
+	assert.Len(t, newReporter.spans, 2)
+}
@@ -21,8 +21,9 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
-	"strings"
 	"sync/atomic"
+
+	"github.com/megaease/easeagent-sdk-go/headermatch"
 )
 
 const (
@@ -46,7 +47,7 @@ type (
 	// Agent is the agent entry.
 	Agent struct {
 		agentInfo *AgentInfo
-		headers   atomic.Value // type: []string
+		headers   atomic.Value // type: *headermatch.Matcher
 	}
 
 	// AgentInfo stores agent information.
@@ -60,6 +61,12 @@ type (
 		Headers string `json:"easeagent.progress.forwarded.headers"`
 	}
 
+	// ForwardedHeadersInfo shows the forwarded headers for debugging.
+	ForwardedHeadersInfo struct {
+		Patterns []string `json:"patterns"`
+		Matched  []string `json:"matched"`
+	}
+
 	// AgentHandler is the HTTP handler wrapper.
 	AgentHandler struct {
 		handlerFunc http.HandlerFunc
@@ -74,7 +81,7 @@ func NewAgent(agentType string) *Agent {
 			Version: agentVersion,
 		},
 	}
-	a.headers.Store([]string{})
+	a.headers.Store(headermatch.MustParse(""))
 	return a
 }
 
@@ -114,6 +121,10 @@ func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path == "/agent-info" {
 		a.handleAgentInfo(w, r)
 	}
+
+	if r.URL.Path == "/forwarded-headers" {
+		a.handleForwardedHeaders(w, r)
+	}
 }
 
 func (a *Agent) handleConfig(w http.ResponseWriter, r *http.Request) {
@@ -132,8 +143,13 @@ func (a *Agent) handleConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	headers := strings.Split(config.Headers, ",")
-	a.headers.Store(headers)
+	matcher, err := headermatch.Parse(config.Headers)
+	if err != nil {
+		log.Printf("parse forwarded headers failed: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	a.headers.Store(matcher)
 }
 
 func (a *Agent) handleAgentInfo(w http.ResponseWriter, r *http.Request) {
@@ -146,9 +162,42 @@ func (a *Agent) handleAgentInfo(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-// Headers returns HTTP header keys which need to be transmit along the chain.
+func (a *Agent) handleForwardedHeaders(w http.ResponseWriter, r *http.Request) {
+	matcher := a.matcher()
+	info := &ForwardedHeadersInfo{
+		Patterns: matcher.Patterns(),
+		Matched:  matcher.Matched(),
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		log.Printf("marshal forwarded headers failed: %v", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Write(data)
+}
+
+func (a *Agent) matcher() *headermatch.Matcher {
+	return a.headers.Load().(*headermatch.Matcher)
+}
+
+// Headers returns HTTP header keys which need to be transmit along the chain,
+// the prefixes and the regular expressions are not included, see HeaderPatterns.
 func (a *Agent) Headers() []string {
-	return a.headers.Load().([]string)
+	return a.matcher().Names()
+}
+
+// HeaderPatterns returns HTTP header patterns which need to be transmit along the chain,
+// see headermatch.Matcher for the pattern formats.
+func (a *Agent) HeaderPatterns() []string {
+	return a.matcher().Patterns()
+}
+
+// MatchedHeaders returns the HTTP header keys which have been transmitted along the chain.
+func (a *Agent) MatchedHeaders() []string {
+	return a.matcher().Matched()
 }
 
 // Headers is the wrapper of Headers of default agent.
@@ -156,15 +205,17 @@ func Headers() []string {
 	return DefaultAgent.Headers()
 }
 
+// HeaderPatterns is the wrapper of HeaderPatterns of default agent.
+func HeaderPatterns() []string {
+	return DefaultAgent.HeaderPatterns()
+}
+
 // WrapHandleFunc wraps http.HandleFunc to serve agent role.
 // It copies canary headers to reponse writer, the function itself must not alter them.
 func (a *Agent) WrapHandleFunc(fn http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		keys := a.headers.Load().([]string)
-		for k, v := range r.Header.Clone() {
-			if strInSlice(k, keys) {
-				w.Header()[k] = v
-			}
+		for k, v := range a.matcher().Filter(r.Header) {
+			w.Header()[k] = v
 		}
 
 		fn(w, r)
@@ -194,13 +245,3 @@ func WrapHandler(fn http.Handler) http.Handler {
 func (h *AgentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.handlerFunc(w, r)
 }
-
-func strInSlice(s string, ss []string) bool {
-	for _, str := range ss {
-		if s == str {
-			return true
-		}
-	}
-
-	return false
-}